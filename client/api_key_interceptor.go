@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+//APIKeyInterceptor is a client interceptor authenticating service callers with an API key instead of a login
+type APIKeyInterceptor struct {
+	apiKey      string
+	authMethods map[string]bool
+}
+
+//NewAPIKeyInterceptor is the constructor
+func NewAPIKeyInterceptor(apiKey string, authMethods map[string]bool) *APIKeyInterceptor {
+	return &APIKeyInterceptor{
+		apiKey:      apiKey,
+		authMethods: authMethods,
+	}
+}
+
+//Unary returns a client interceptor attaching the API key to the unary rpc
+func (interceptor *APIKeyInterceptor) Unary() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if interceptor.authMethods[method] {
+			return invoker(interceptor.attachAPIKey(ctx), method, req, reply, cc, opts...)
+		}
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+//Stream returns a client interceptor attaching the API key to the stream rpc
+func (interceptor *APIKeyInterceptor) Stream() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if interceptor.authMethods[method] {
+			return streamer(interceptor.attachAPIKey(ctx), desc, cc, method, opts...)
+		}
+
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+func (interceptor *APIKeyInterceptor) attachAPIKey(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "x-api-key", interceptor.apiKey)
+}
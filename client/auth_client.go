@@ -2,17 +2,25 @@ package client
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/niroopreddym/interceptors-grpc-go/pb"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
-//AuthClient to authenticate
+//AuthClient to authenticate, OneTimeCode supplies the TOTP code of users enrolled in two-factor authentication
 type AuthClient struct {
-	service  pb.AuthServiceClient
-	username string
-	password string
+	OneTimeCode  func() (string, error)
+	service      pb.AuthServiceClient
+	username     string
+	password     string
+	mutex        sync.Mutex
+	refreshToken string
 }
 
 //NewAuthClient is the ctor
@@ -27,18 +35,87 @@ func NewAuthClient(cc *grpc.ClientConn, username string, password string) *AuthC
 
 //Login logs in and returns the access token
 func (client *AuthClient) Login() (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
 	req := &pb.LoginRequest{
 		Username: client.username,
 		Password: client.password,
 	}
 
+	if client.OneTimeCode != nil {
+		code, err := client.OneTimeCode()
+		if err != nil {
+			return "", fmt.Errorf("cannot get one-time code: %w", err)
+		}
+
+		req.OneTimeCode = code
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
 	res, err := client.service.Login(ctx, req)
 	if err != nil {
 		return "", err
 	}
 
+	client.setRefreshToken(res.GetRefreshToken())
 	return res.GetAccessToken(), nil
 }
+
+//Refresh exchanges the refresh token for a new access token, it logs in again
+//when there is no refresh token or the server no longer accepts it
+func (client *AuthClient) Refresh() (string, error) {
+	client.mutex.Lock()
+	refreshToken := client.refreshToken
+	client.mutex.Unlock()
+
+	if refreshToken == "" {
+		return client.Login()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req := &pb.RefreshTokenRequest{
+		RefreshToken: refreshToken,
+	}
+
+	res, err := client.service.RefreshToken(ctx, req)
+	if status.Code(err) == codes.Unauthenticated {
+		return client.Login()
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	client.setRefreshToken(res.GetRefreshToken())
+	return res.GetAccessToken(), nil
+}
+
+//Logout revokes the access token and the refresh token of the client
+func (client *AuthClient) Logout(accessToken string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client.mutex.Lock()
+	req := &pb.LogoutRequest{
+		RefreshToken: client.refreshToken,
+	}
+	client.mutex.Unlock()
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", accessToken)
+	_, err := client.service.Logout(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	client.setRefreshToken("")
+	return nil
+}
+
+func (client *AuthClient) setRefreshToken(refreshToken string) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.refreshToken = refreshToken
+}
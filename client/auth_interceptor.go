@@ -3,92 +3,223 @@ package client
 import (
 	"context"
 	"log"
+	"sync"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
-//AuthInterceptor is a client interceptor for authentication
+//AuthInterceptor is a client interceptor for authentication, the access token is refreshed
+//in the background until Close is called and the client logs in again once when the server
+//rejects the token
 type AuthInterceptor struct {
-	authClient  *AuthClient
 	authMethods map[string]bool
-	accessToken string
+	tokens      *tokenSource
 }
 
-//NewAuthInterceptor is the constructor
-func NewAuthInterceptor(authClient *AuthClient, authMethods map[string]bool, refreshDuration time.Duration) (*AuthInterceptor, error) {
-	interceptor := &AuthInterceptor{
-		authClient:  authClient,
-		authMethods: authMethods,
-	}
-
-	err := interceptor.scheduleRefreshToken(refreshDuration)
+//NewAuthInterceptor is the constructor, the access token is refreshed refreshSkew before it expires
+func NewAuthInterceptor(authClient *AuthClient, authMethods map[string]bool, refreshSkew time.Duration) (*AuthInterceptor, error) {
+	tokens, err := newTokenSource(authClient, refreshSkew)
 	if err != nil {
 		return nil, err
 	}
 
+	interceptor := &AuthInterceptor{
+		authMethods: authMethods,
+		tokens:      tokens,
+	}
+
 	return interceptor, nil
 }
 
-func (interceptor *AuthInterceptor) scheduleRefreshToken(refreshDuration time.Duration) error {
-	err := interceptor.refreshToken()
-	if err != nil {
-		return err
+//Close stops the background refresh of the access token
+func (interceptor *AuthInterceptor) Close() error {
+	interceptor.tokens.Close()
+	return nil
+}
+
+//Unary returns a server intereptor to autheticate the unary rpc, a call rejected as
+//unauthenticated is replayed once with the token of a new login
+func (interceptor *AuthInterceptor) Unary() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if !interceptor.authMethods[method] {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		accessToken, err := interceptor.tokens.Token(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = invoker(attachToken(ctx, accessToken), method, req, reply, cc, opts...)
+		if status.Code(err) != codes.Unauthenticated {
+			return err
+		}
+
+		accessToken, ok := interceptor.renewToken(ctx, method, accessToken)
+		if !ok {
+			return err
+		}
+
+		return invoker(attachToken(ctx, accessToken), method, req, reply, cc, opts...)
 	}
+}
+
+//Stream returns a server intereptor to autheticate the stream rpc, a stream rejected as
+//unauthenticated before the client sent a message is opened again with the token of a new login
+func (interceptor *AuthInterceptor) Stream() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if !interceptor.authMethods[method] {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		accessToken, err := interceptor.tokens.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
 
-	go func() {
-		wait := refreshDuration
-		for {
-			time.Sleep(wait)
-			err := interceptor.refreshToken()
-			if err != nil {
-				wait = time.Second
-			} else {
-				wait = refreshDuration
+		stream, err := streamer(attachToken(ctx, accessToken), desc, cc, method, opts...)
+		if status.Code(err) == codes.Unauthenticated {
+			var ok bool
+			accessToken, ok = interceptor.renewToken(ctx, method, accessToken)
+			if !ok {
+				return nil, err
 			}
+
+			stream, err = streamer(attachToken(ctx, accessToken), desc, cc, method, opts...)
 		}
-	}()
 
-	return nil
+		if err != nil {
+			return nil, err
+		}
+
+		reauthStream := &reauthStream{
+			ClientStream: stream,
+			interceptor:  interceptor,
+			accessToken:  accessToken,
+			open: func(accessToken string) (grpc.ClientStream, error) {
+				return streamer(attachToken(ctx, accessToken), desc, cc, method, opts...)
+			},
+			ctx:    ctx,
+			method: method,
+		}
+
+		return reauthStream, nil
+	}
 }
 
-func (interceptor *AuthInterceptor) refreshToken() error {
-	accessToken, err := interceptor.authClient.Login()
+//renewToken logs in again after the server rejected the access token, false when the login failed
+func (interceptor *AuthInterceptor) renewToken(ctx context.Context, method string, stale string) (string, bool) {
+	accessToken, err := interceptor.tokens.Renew(ctx, stale)
 	if err != nil {
-		return err
+		log.Printf("cannot log in again after %s was rejected: %v", method, err)
+		return "", false
 	}
 
-	interceptor.accessToken = accessToken
-	log.Printf("token refreshed: %v", accessToken)
-	return nil
+	log.Printf("logged in again after %s was rejected", method)
+	return accessToken, true
 }
 
-//Unary returns a server intereptor to autheticate the unary rpc
-func (interceptor *AuthInterceptor) Unary() grpc.UnaryClientInterceptor {
-	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		log.Println("--> unary interceptor: ", method)
+func attachToken(ctx context.Context, accessToken string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", accessToken)
+}
 
-		if interceptor.authMethods[method] {
-			return invoker(interceptor.attachToken(ctx), method, req, reply, cc, opts...)
-		}
+//reauthStream opens the stream again with the token of a new login when the server rejects it
+//as unauthenticated before any message was sent, later rejections only renew the token
+type reauthStream struct {
+	grpc.ClientStream
+	interceptor *AuthInterceptor
+	open        func(accessToken string) (grpc.ClientStream, error)
+	ctx         context.Context
+	method      string
+	mutex       sync.Mutex
+	accessToken string
+	sent        bool
+	renewed     bool
+}
 
-		return invoker(ctx, method, req, reply, cc, opts...)
-	}
+func (stream *reauthStream) current() grpc.ClientStream {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	return stream.ClientStream
 }
 
-//Stream returns a server intereptor to autheticate the stream rpc
-func (interceptor *AuthInterceptor) Stream() grpc.StreamClientInterceptor {
-	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
-		log.Println("--> stream interceptor: ", method)
-		if interceptor.authMethods[method] {
-			return streamer(interceptor.attachToken(ctx), desc, cc, method, opts...)
-		}
+//SendMsg sends the message on the current stream, the stream is no longer replayed afterwards
+func (stream *reauthStream) SendMsg(m interface{}) error {
+	stream.mutex.Lock()
+	stream.sent = true
+	current := stream.ClientStream
+	stream.mutex.Unlock()
+
+	return current.SendMsg(m)
+}
+
+//RecvMsg receives a message, opening the stream again when it was rejected before anything was sent
+func (stream *reauthStream) RecvMsg(m interface{}) error {
+	err := stream.current().RecvMsg(m)
+	if stream.reopen(err) {
+		return stream.current().RecvMsg(m)
+	}
+
+	return err
+}
 
-		return streamer(ctx, desc, cc, method, opts...)
+//Header returns the header metadata, opening the stream again when it was rejected before anything was sent
+func (stream *reauthStream) Header() (metadata.MD, error) {
+	header, err := stream.current().Header()
+	if stream.reopen(err) {
+		return stream.current().Header()
 	}
+
+	return header, err
 }
 
-func (interceptor *AuthInterceptor) attachToken(ctx context.Context) context.Context {
-	return metadata.AppendToOutgoingContext(ctx, "authorization", interceptor.accessToken)
+//CloseSend closes the sending side of the current stream
+func (stream *reauthStream) CloseSend() error {
+	return stream.current().CloseSend()
+}
+
+//Trailer returns the trailer metadata of the current stream
+func (stream *reauthStream) Trailer() metadata.MD {
+	return stream.current().Trailer()
+}
+
+//Context returns the context of the current stream
+func (stream *reauthStream) Context() context.Context {
+	return stream.current().Context()
+}
+
+//reopen renews the token once after the stream was rejected as unauthenticated and, when no message
+//was sent yet, replaces the stream with one opened with the new token and returns true
+func (stream *reauthStream) reopen(err error) bool {
+	if status.Code(err) != codes.Unauthenticated {
+		return false
+	}
+
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	if stream.renewed {
+		return false
+	}
+
+	stream.renewed = true
+	accessToken, ok := stream.interceptor.renewToken(stream.ctx, stream.method, stream.accessToken)
+	if !ok || stream.sent {
+		return false
+	}
+
+	other, err := stream.open(accessToken)
+	if err != nil {
+		log.Printf("cannot open %s again: %v", stream.method, err)
+		return false
+	}
+
+	stream.ClientStream = other
+	stream.accessToken = accessToken
+	return true
 }
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testMethod = "/pb.LaptopService/CreateLaptop"
+
+//fakeClientStream fails to receive when the server rejected its token
+type fakeClientStream struct {
+	grpc.ClientStream
+	rejected bool
+}
+
+func (stream *fakeClientStream) SendMsg(m interface{}) error {
+	return nil
+}
+
+func (stream *fakeClientStream) RecvMsg(m interface{}) error {
+	if stream.rejected {
+		return status.Errorf(codes.Unauthenticated, "access token is invalid")
+	}
+
+	return nil
+}
+
+func newTestAuthInterceptor(t *testing.T) (*AuthInterceptor, *fakeAuthService) {
+	service := &fakeAuthService{lifetimes: []time.Duration{time.Hour}}
+	interceptor, err := NewAuthInterceptor(&AuthClient{service: service}, map[string]bool{testMethod: true}, time.Minute)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		interceptor.Close()
+	})
+
+	return interceptor, service
+}
+
+//rejectTokens returns a check rejecting the tokens the interceptor holds now
+func rejectTokens(interceptor *AuthInterceptor, all bool) func(ctx context.Context) bool {
+	rejected := interceptor.tokens.current().value
+	return func(ctx context.Context) bool {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		return all || md.Get("authorization")[0] == rejected
+	}
+}
+
+func TestAuthInterceptorUnaryRetry(t *testing.T) {
+	t.Parallel()
+
+	interceptor, service := newTestAuthInterceptor(t)
+	for _, all := range []bool{false, true} {
+		rejected := rejectTokens(interceptor, all)
+		logins := atomic.LoadInt32(&service.logins)
+
+		var calls int
+		invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			calls++
+			if rejected(ctx) {
+				return status.Errorf(codes.Unauthenticated, "access token is invalid")
+			}
+
+			return nil
+		}
+
+		err := interceptor.Unary()(context.Background(), testMethod, nil, nil, nil, invoker)
+		require.Equal(t, 2, calls)
+		require.Equal(t, logins+1, atomic.LoadInt32(&service.logins))
+		if all {
+			require.Equal(t, codes.Unauthenticated, status.Code(err))
+		} else {
+			require.NoError(t, err)
+		}
+	}
+}
+
+func TestAuthInterceptorStreamRetry(t *testing.T) {
+	t.Parallel()
+
+	interceptor, service := newTestAuthInterceptor(t)
+	for _, send := range []bool{false, true} {
+		rejected := rejectTokens(interceptor, false)
+		logins := atomic.LoadInt32(&service.logins)
+
+		var opened int
+		streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			opened++
+			return &fakeClientStream{rejected: rejected(ctx)}, nil
+		}
+
+		stream, err := interceptor.Stream()(context.Background(), &grpc.StreamDesc{}, nil, testMethod, streamer)
+		require.NoError(t, err)
+
+		if send {
+			require.NoError(t, stream.SendMsg(nil))
+		}
+
+		err = stream.RecvMsg(nil)
+		require.Equal(t, logins+1, atomic.LoadInt32(&service.logins))
+		if send {
+			//the message may have reached the server so the stream is not replayed
+			require.Equal(t, codes.Unauthenticated, status.Code(err))
+			require.Equal(t, 1, opened)
+		} else {
+			require.NoError(t, err)
+			require.Equal(t, 2, opened)
+		}
+	}
+}
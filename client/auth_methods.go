@@ -0,0 +1,62 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/niroopreddym/interceptors-grpc-go/pb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+//AuthMethods returns the full names of the RPCs the access token is sent to, which are the RPCs
+//with a (pb.auth) option not authenticated by the client certificate alone, public RPCs included
+//so that the server sees the tenant of the caller, except the auth service RPCs issuing the token
+func AuthMethods() map[string]bool {
+	authMethods := make(map[string]bool)
+	protoregistry.GlobalFiles.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		services := file.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				if sendsAccessToken(methods.Get(j)) {
+					authMethods[fmt.Sprintf("/%s/%s", services.Get(i).FullName(), methods.Get(j).Name())] = true
+				}
+			}
+		}
+
+		return true
+	})
+
+	return authMethods
+}
+
+//isAuthMethod tells whether the access token is sent to the RPC of the full method name "/package.Service/Method",
+//the RPCs of services the client does not know the descriptors of get no token
+func isAuthMethod(fullMethod string) bool {
+	name := protoreflect.FullName(strings.Replace(strings.TrimPrefix(fullMethod, "/"), "/", ".", 1))
+	descriptor, err := protoregistry.GlobalFiles.FindDescriptorByName(name)
+	if err != nil {
+		return false
+	}
+
+	method, ok := descriptor.(protoreflect.MethodDescriptor)
+	return ok && sendsAccessToken(method)
+}
+
+func sendsAccessToken(method protoreflect.MethodDescriptor) bool {
+	options, ok := method.Options().(*descriptorpb.MethodOptions)
+	if !ok || options == nil || !proto.HasExtension(options, pb.E_Auth) {
+		return false
+	}
+
+	authRule := proto.GetExtension(options, pb.E_Auth).(*pb.AuthRule)
+	if authRule.GetPublic() {
+		//the token cannot be sent to the RPCs it is obtained from
+		return string(method.Parent().FullName()) != pb.AuthService_ServiceDesc.ServiceName
+	}
+
+	return authRule.GetAuthn() != pb.AuthRule_CERT
+}
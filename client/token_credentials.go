@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+//TokenCredentials attaches the access token of the auth client to every RPC needing one, it
+//implements credentials.PerRPCCredentials for grpc.WithPerRPCCredentials and keeps the token
+//fresh in the background until Close is called
+type TokenCredentials struct {
+	tokens *tokenSource
+}
+
+//NewTokenCredentials is the constructor, the access token is refreshed refreshSkew before it expires
+func NewTokenCredentials(authClient *AuthClient, refreshSkew time.Duration) (*TokenCredentials, error) {
+	tokens, err := newTokenSource(authClient, refreshSkew)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenCredentials{
+		tokens: tokens,
+	}, nil
+}
+
+//GetRequestMetadata returns the authorization metadata, the RPCs that do not need an access token
+//according to their (pb.auth) option such as the login itself get none
+func (creds *TokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	requestInfo, ok := credentials.RequestInfoFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("cannot get the request info of the rpc")
+	}
+
+	return creds.requestMetadata(ctx, requestInfo.Method, requestInfo.AuthInfo)
+}
+
+func (creds *TokenCredentials) requestMetadata(ctx context.Context, method string, authInfo credentials.AuthInfo) (map[string]string, error) {
+	if !isAuthMethod(method) {
+		return nil, nil
+	}
+
+	err := credentials.CheckSecurityLevel(authInfo, credentials.PrivacyAndIntegrity)
+	if err != nil {
+		return nil, fmt.Errorf("cannot send the access token over this connection: %w", err)
+	}
+
+	accessToken, err := creds.tokens.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"authorization": accessToken}, nil
+}
+
+//RequireTransportSecurity requires a secure connection since the access token is a bearer token
+func (creds *TokenCredentials) RequireTransportSecurity() bool {
+	return true
+}
+
+//Close stops the background refresh of the access token
+func (creds *TokenCredentials) Close() error {
+	creds.tokens.Close()
+	return nil
+}
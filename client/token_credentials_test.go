@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/credentials"
+)
+
+//fakeAuthInfo is the auth info of a connection with the security level
+type fakeAuthInfo struct {
+	credentials.CommonAuthInfo
+}
+
+func (authInfo fakeAuthInfo) AuthType() string {
+	return "fake"
+}
+
+func TestTokenCredentials(t *testing.T) {
+	t.Parallel()
+
+	service := &fakeAuthService{lifetimes: []time.Duration{time.Hour}}
+	creds, err := NewTokenCredentials(&AuthClient{service: service}, time.Minute)
+	require.NoError(t, err)
+	defer creds.Close()
+
+	require.True(t, creds.RequireTransportSecurity())
+
+	secure := fakeAuthInfo{credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity}}
+	md, err := creds.requestMetadata(context.Background(), "/pb.LaptopService/CreateLaptop", secure)
+	require.NoError(t, err)
+	require.Equal(t, creds.tokens.current().value, md["authorization"])
+
+	//public RPCs get the token so the server resolves the tenant of the caller
+	md, err = creds.requestMetadata(context.Background(), "/pb.LaptopService/SearchLaptop", secure)
+	require.NoError(t, err)
+	require.Equal(t, creds.tokens.current().value, md["authorization"])
+
+	//the login itself and the RPCs of unknown services get no token
+	for _, method := range []string{"/pb.AuthService/Login", "/pb.AuthService/RefreshToken", "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo", "/pb.LaptopService/Unknown"} {
+		md, err = creds.requestMetadata(context.Background(), method, secure)
+		require.NoError(t, err)
+		require.Empty(t, md, method)
+	}
+
+	insecure := fakeAuthInfo{credentials.CommonAuthInfo{SecurityLevel: credentials.NoSecurity}}
+	_, err = creds.requestMetadata(context.Background(), "/pb.LaptopService/CreateLaptop", insecure)
+	require.Error(t, err)
+
+	_, err = creds.GetRequestMetadata(context.Background())
+	require.Error(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&service.logins))
+}
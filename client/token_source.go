@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+//refreshRetryDelay is the wait before the background refresh is tried again after a failure
+const refreshRetryDelay = time.Second
+
+//tokenSource keeps the access token of the auth client fresh, the token is refreshed in the background
+//skew before it expires and callers finding it expired share a single refresh
+type tokenSource struct {
+	authClient *AuthClient
+	skew       time.Duration
+	token      atomic.Value
+	mutex      sync.Mutex
+	refreshing *refreshCall
+	ctx        context.Context
+	cancel     context.CancelFunc
+	stopped    chan struct{}
+}
+
+//accessToken is an access token with the expiry read from its exp claim, zero when it has none
+type accessToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+//refreshCall is a refresh in flight, done is closed once token or err is set
+type refreshCall struct {
+	done  chan struct{}
+	token *accessToken
+	err   error
+}
+
+//newTokenSource fetches the first token and starts the background refresh
+func newTokenSource(authClient *AuthClient, skew time.Duration) (*tokenSource, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	source := &tokenSource{
+		authClient: authClient,
+		skew:       skew,
+		ctx:        ctx,
+		cancel:     cancel,
+		stopped:    make(chan struct{}),
+	}
+
+	_, err := source.refresh(ctx, false)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	go source.refreshLoop()
+	return source, nil
+}
+
+//Token returns a valid access token, refreshing it first when it expired
+func (source *tokenSource) Token(ctx context.Context) (string, error) {
+	token := source.current()
+	if token != nil && !token.expired(time.Now()) {
+		return token.value, nil
+	}
+
+	token, err := source.refresh(ctx, false)
+	if err != nil {
+		return "", err
+	}
+
+	return token.value, nil
+}
+
+//Renew logs in again after the server rejected the stale token, unless the token was already
+//replaced since it was handed out
+func (source *tokenSource) Renew(ctx context.Context, stale string) (string, error) {
+	token := source.current()
+	if token != nil && token.value != stale {
+		return token.value, nil
+	}
+
+	token, err := source.refresh(ctx, true)
+	if err != nil {
+		return "", err
+	}
+
+	return token.value, nil
+}
+
+//Close stops the background refresh and waits for the refresh loop to return
+func (source *tokenSource) Close() {
+	source.cancel()
+	<-source.stopped
+}
+
+func (source *tokenSource) current() *accessToken {
+	token, _ := source.token.Load().(*accessToken)
+	return token
+}
+
+//refresh fetches a new token, with login by logging in instead of presenting the refresh token,
+//callers arriving while a refresh is in flight wait for its result until their context is done
+func (source *tokenSource) refresh(ctx context.Context, login bool) (*accessToken, error) {
+	source.mutex.Lock()
+	call := source.refreshing
+	if call == nil {
+		call = &refreshCall{done: make(chan struct{})}
+		source.refreshing = call
+		go source.doRefresh(call, login)
+	}
+	source.mutex.Unlock()
+
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (source *tokenSource) doRefresh(call *refreshCall, login bool) {
+	defer func() {
+		source.mutex.Lock()
+		source.refreshing = nil
+		source.mutex.Unlock()
+		close(call.done)
+	}()
+
+	refresh := source.authClient.Refresh
+	if login {
+		refresh = source.authClient.Login
+	}
+
+	value, err := refresh()
+	if err != nil {
+		call.err = fmt.Errorf("cannot refresh access token: %w", err)
+		return
+	}
+
+	call.token = &accessToken{
+		value:     value,
+		expiresAt: tokenExpiry(value),
+	}
+
+	source.token.Store(call.token)
+	log.Printf("token refreshed, expires at %v", call.token.expiresAt)
+}
+
+//refreshLoop refreshes the token skew before it expires until the source is closed
+func (source *tokenSource) refreshLoop() {
+	defer close(source.stopped)
+
+	wait, ok := source.nextRefresh()
+	for ok {
+		timer := time.NewTimer(wait)
+		select {
+		case <-source.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		_, err := source.refresh(source.ctx, false)
+		if source.ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			log.Print(err)
+			wait = refreshRetryDelay
+			continue
+		}
+
+		wait, ok = source.nextRefresh()
+	}
+
+	//a token without an expiry never needs a refresh
+	<-source.ctx.Done()
+}
+
+//nextRefresh returns the wait before the current token should be refreshed, false when it does not expire
+func (source *tokenSource) nextRefresh() (time.Duration, bool) {
+	token := source.current()
+	if token == nil || token.expiresAt.IsZero() {
+		return 0, false
+	}
+
+	wait := time.Until(token.expiresAt.Add(-source.skew))
+	if wait < refreshRetryDelay {
+		wait = refreshRetryDelay
+	}
+
+	return wait, true
+}
+
+func (token *accessToken) expired(now time.Time) bool {
+	return !token.expiresAt.IsZero() && !now.Before(token.expiresAt)
+}
+
+//tokenExpiry reads the exp claim of the access token, the client cannot verify the signature
+//and only uses the expiry to schedule the refresh
+func tokenExpiry(value string) time.Time {
+	claims := &jwt.StandardClaims{}
+	_, _, err := new(jwt.Parser).ParseUnverified(value, claims)
+	if err != nil || claims.ExpiresAt == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(claims.ExpiresAt, 0)
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/niroopreddym/interceptors-grpc-go/pb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+//fakeAuthService issues an access token expiring after the lifetime of the login
+type fakeAuthService struct {
+	pb.AuthServiceClient
+	logins    int32
+	delay     time.Duration
+	lifetimes []time.Duration
+}
+
+func (service *fakeAuthService) Login(ctx context.Context, req *pb.LoginRequest, opts ...grpc.CallOption) (*pb.LoginResponse, error) {
+	login := int(atomic.AddInt32(&service.logins, 1)) - 1
+	time.Sleep(service.delay)
+
+	lifetime := service.lifetimes[len(service.lifetimes)-1]
+	if login < len(service.lifetimes) {
+		lifetime = service.lifetimes[login]
+	}
+
+	claims := jwt.StandardClaims{Id: fmt.Sprint(login), ExpiresAt: time.Now().Add(lifetime).Unix()}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.LoginResponse{AccessToken: token}, nil
+}
+
+func TestTokenSourceSingleFlight(t *testing.T) {
+	t.Parallel()
+
+	service := &fakeAuthService{delay: 50 * time.Millisecond, lifetimes: []time.Duration{-time.Minute, time.Hour}}
+	source, err := newTokenSource(&AuthClient{service: service}, time.Second)
+	require.NoError(t, err)
+	defer source.Close()
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	errs := make([]error, len(tokens))
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], errs[i] = source.Token(context.Background())
+		}(i)
+	}
+
+	wg.Wait()
+	require.Equal(t, int32(2), atomic.LoadInt32(&service.logins))
+	for i, token := range tokens {
+		require.NoError(t, errs[i])
+		require.Equal(t, tokens[0], token)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	token, err := source.Token(ctx)
+	require.NoError(t, err)
+	require.Equal(t, tokens[0], token)
+}
+
+func TestTokenSourceRefreshBeforeExpiry(t *testing.T) {
+	t.Parallel()
+
+	service := &fakeAuthService{lifetimes: []time.Duration{3 * time.Second, time.Hour}}
+	source, err := newTokenSource(&AuthClient{service: service}, 2*time.Second)
+	require.NoError(t, err)
+
+	first := source.current()
+	require.WithinDuration(t, time.Now().Add(3*time.Second), first.expiresAt, time.Second)
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&service.logins) == 2
+	}, 3*time.Second, 10*time.Millisecond)
+	require.NotEqual(t, first.value, source.current().value)
+
+	closed := make(chan struct{})
+	go func() {
+		source.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("close did not stop the refresh loop")
+	}
+
+	source.Close()
+	require.Equal(t, int32(2), atomic.LoadInt32(&service.logins))
+}
@@ -1,16 +1,19 @@
 package main
 
 import (
+	"bufio"
 	"crypto/tls"
 	"crypto/x509"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/niroopreddym/interceptors-grpc-go/client"
+	"github.com/niroopreddym/interceptors-grpc-go/interceptors"
 	"github.com/niroopreddym/interceptors-grpc-go/pb"
 	"github.com/niroopreddym/interceptors-grpc-go/sample"
 	"google.golang.org/grpc"
@@ -18,20 +21,11 @@ import (
 )
 
 const (
-	username        = "admin1"
-	password        = "secret"
-	refreshDuration = 30 * time.Second
+	username    = "admin1"
+	password    = "secret"
+	refreshSkew = 30 * time.Second
 )
 
-func authMethods() map[string]bool {
-	const laptopServicePath = " /pb.LaptopService"
-	return map[string]bool{
-		laptopServicePath + "CreateLaptop": true,
-		laptopServicePath + "UploadImage":  true,
-		laptopServicePath + "RateLaptop":   true,
-	}
-}
-
 func loadTLSCredentials() (credentials.TransportCredentials, error) {
 	//this below code is for mutual authentication
 	//load server certificate and private key
@@ -62,6 +56,8 @@ func loadTLSCredentials() (credentials.TransportCredentials, error) {
 
 func main() {
 	serverAddress := flag.String("address", "", "the server address")
+	apiKey := flag.String("api-key", "", "authenticate with the API key instead of logging in")
+	otp := flag.Bool("otp", false, "prompt for the one-time code of the two-factor authentication when logging in")
 	flag.Parse()
 	log.Printf("dial server %s", *serverAddress)
 
@@ -75,15 +71,38 @@ func main() {
 		log.Fatal("cannot dial server: ", err)
 	}
 
-	// use the above connection to ocnnect to auth client
-	authClient := client.NewAuthClient(cc1, username, password)
-	interceptor, err := client.NewAuthInterceptor(authClient, authMethods(), refreshDuration)
+	var interceptor interceptors.ClientInterceptor
+	if *apiKey != "" {
+		interceptor = client.NewAPIKeyInterceptor(*apiKey, client.AuthMethods())
+	} else {
+		// use the above connection to ocnnect to auth client
+		authClient := client.NewAuthClient(cc1, username, password)
+		if *otp {
+			authClient.OneTimeCode = promptOneTimeCode
+		}
+
+		authInterceptor, err := client.NewAuthInterceptor(authClient, client.AuthMethods(), refreshSkew)
+
+		if err != nil {
+			log.Fatal("cannot create auth interceptor: ", err)
+		}
+		defer authInterceptor.Close()
+
+		interceptor = authInterceptor
+	}
+
+	chain := interceptors.NewClientChain()
+	err = chain.Use(interceptors.NewLoggingClientInterceptor(interceptors.LoggingOptions{Level: interceptors.LevelInfo}), interceptors.All)
+	if err != nil {
+		log.Fatal("cannot add logging interceptor: ", err)
+	}
 
+	err = chain.Use(interceptor, interceptors.All)
 	if err != nil {
-		log.Fatal("cannot create auth interceptor: ", err)
+		log.Fatal("cannot add auth interceptor: ", err)
 	}
 
-	cc2, err := grpc.Dial(*serverAddress, grpc.WithTransportCredentials(tlsCredentials), grpc.WithUnaryInterceptor(interceptor.Unary()), grpc.WithStreamInterceptor(interceptor.Stream()))
+	cc2, err := grpc.Dial(*serverAddress, append([]grpc.DialOption{grpc.WithTransportCredentials(tlsCredentials)}, chain.DialOptions()...)...)
 	if err != nil {
 		log.Fatal("cannot dial server: ", err)
 	}
@@ -94,6 +113,16 @@ func main() {
 	testRateLaptop(laptopClient)
 }
 
+func promptOneTimeCode() (string, error) {
+	fmt.Print("one-time code: ")
+	code, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(code), nil
+}
+
 func testCreateLaptop(laptopClient client.LaptopClient) {
 	laptopClient.CreateLaptop(sample.NewLaptop())
 }
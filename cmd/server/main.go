@@ -10,6 +10,7 @@ import (
 	"net"
 	"time"
 
+	"github.com/niroopreddym/interceptors-grpc-go/interceptors"
 	"github.com/niroopreddym/interceptors-grpc-go/pb"
 	"github.com/niroopreddym/interceptors-grpc-go/service"
 	"github.com/niroopreddym/interceptors-grpc-go/store"
@@ -19,21 +20,36 @@ import (
 )
 
 const (
-	secretKey     = "secret"
-	tokenDuration = 15 * time.Minute
+	secretKey            = "secret"
+	tokenDuration        = 15 * time.Minute
+	refreshTokenDuration = 24 * time.Hour
+	policyReloadInterval = 5 * time.Second
+	maxLoginFailures     = 5
+	loginBackoff         = time.Second
+	loginLockDuration    = 15 * time.Minute
 )
 
-func seedUsers(userStore store.UserStore) error {
-	err := createUser(userStore, "admin1", "secret", "admin")
+//reflectionServicePath is the path of the methods of the server reflection service
+const reflectionServicePath = "/grpc.reflection.v1alpha.ServerReflection/"
+
+//tokenIssuingMethods skip the auth interceptor so that a stale access token sent along cannot
+//keep a client from getting a new one, the access policy cannot restrict these methods
+var tokenIssuingMethods = []string{
+	"/pb.AuthService/Login",
+	"/pb.AuthService/RefreshToken",
+}
+
+func seedUsers(userStore store.UserStore, passwordHasher store.PasswordHasher) error {
+	err := createUser(userStore, passwordHasher, "admin1", "secret", "admin")
 	if err != nil {
 		return err
 	}
 
-	return createUser(userStore, "user1", "secret", "user")
+	return createUser(userStore, passwordHasher, "user1", "secret", "user")
 }
 
-func createUser(userStore store.UserStore, userName string, password string, role string) error {
-	user, err := store.NewUser(userName, password, role)
+func createUser(userStore store.UserStore, passwordHasher store.PasswordHasher, userName string, password string, roles ...string) error {
+	user, err := store.NewUser(passwordHasher, userName, password, roles...)
 	if err != nil {
 		return err
 	}
@@ -41,13 +57,37 @@ func createUser(userStore store.UserStore, userName string, password string, rol
 	return userStore.Save(user)
 }
 
-func accessibleRoles() map[string][]string {
-	const laptopServicePath = " /pb.LaptopService"
-	return map[string][]string{
-		laptopServicePath + "CreateLaptop": {"admin"},
-		laptopServicePath + "UploadImage":  {"admin"},
-		laptopServicePath + "RateLaptop":   {"admin", "user"},
+//accessPolicy is enforced when no policy file is given, the rules of the
+//RPCs come from their (pb.auth) options in the proto files and the
+//certificates of the clients in cert/ act as users
+func accessPolicy() *service.AccessPolicy {
+	return &service.AccessPolicy{
+		DefaultDeny: true,
+		ProtoRules:  true,
+		RolePermissions: map[string][]string{
+			"admin": {"laptop:*", "image:upload", "rating:write", "token:revoke", "user:*", "apikey:*", "audit:read"},
+			"user":  {"laptop:write", "image:upload", "rating:write"},
+		},
+		Rules: []service.AccessRule{
+			{Method: reflectionServicePath + "*", Public: true},
+		},
+		CertIdentities: []service.CertIdentity{
+			{Subject: "*.pcclient.com", Roles: []string{"user"}},
+		},
+	}
+}
+
+func newJWTManager(keyFile string, keyID string) (*service.JWTManager, error) {
+	if keyFile == "" {
+		return service.NewJWTManager(secretKey, tokenDuration), nil
+	}
+
+	signingKey, err := service.LoadSigningKey(keyID, keyFile)
+	if err != nil {
+		return nil, err
 	}
+
+	return service.NewJWTManagerWithKey(signingKey, tokenDuration)
 }
 
 func loadTLSCredentials() (credentials.TransportCredentials, error) {
@@ -84,17 +124,47 @@ func loadTLSCredentials() (credentials.TransportCredentials, error) {
 
 func main() {
 	port := flag.Int("port", 0, "the server port")
+	jwtKeyFile := flag.String("jwt-key", "", "PEM file of the RSA or EC private key signing access tokens, HS256 with the shared secret is used when empty")
+	jwtKeyID := flag.String("jwt-kid", "key-1", "the key id of the access token signing key")
+	policyFile := flag.String("policy", "", "JSON or YAML access policy file reloaded on change, the built-in policy is used when empty")
+	bindTokens := flag.Bool("bind-tokens", false, "bind the issued tokens to the client certificate of the caller")
+	passwordHash := flag.String("password-hash", "bcrypt", "the password hash algorithm, one of bcrypt, scrypt and argon2id")
+	logLevel := flag.String("log-level", "info", "the lowest level of the request log lines written, one of debug, info, warn and error")
+	logSampleRate := flag.Float64("log-sample-rate", 1, "the fraction of the request log lines below warn written, 0 writes them all like 1, use -log-level warn to drop them")
 	flag.Parse()
 	log.Printf("satrted the server on port %d", *port)
 
+	requestLogLevel, err := interceptors.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatal("cannot parse log level: ", err)
+	}
+
+	passwordHasher, err := store.NewPasswordHasher(*passwordHash)
+	if err != nil {
+		log.Fatal("cannot create password hasher: ", err)
+	}
+
 	userStore := store.NewInMemoryUserStore()
-	err := seedUsers(userStore)
+	err = seedUsers(userStore, passwordHasher)
 	if err != nil {
 		log.Fatal("cannot seed users")
 	}
 
-	jwtManager := service.NewJWTManager(secretKey, tokenDuration)
-	authServer := service.NewAuthServer(userStore, jwtManager)
+	jwtManager, err := newJWTManager(*jwtKeyFile, *jwtKeyID)
+	if err != nil {
+		log.Fatal("cannot create jwt manager: ", err)
+	}
+
+	refreshTokenStore := store.NewInMemoryRefreshTokenStore()
+	revocationStore := store.NewInMemoryRevocationStore()
+	loginLimiter := service.NewLoginLimiter(maxLoginFailures, loginBackoff, loginLockDuration)
+	authServer := service.NewAuthServer(userStore, jwtManager, passwordHasher, refreshTokenStore, revocationStore, loginLimiter, refreshTokenDuration)
+	authServer.BindTokens = *bindTokens
+	userServer := service.NewUserServer(userStore, passwordHasher, refreshTokenStore, revocationStore, loginLimiter, tokenDuration)
+	apiKeyStore := store.NewInMemoryAPIKeyStore()
+	apiKeyServer := service.NewAPIKeyServer(apiKeyStore)
+	auditStore := store.NewInMemoryAuditStore()
+	auditServer := service.NewAuditServer(auditStore)
 
 	imageStore := store.NewDiskImageStore("C:/Users/maneti.n/go/src/github.com/niroopreddym/interceptors-grpc-go/tmp")
 	ratingStore := store.NewInMemoryRatingStore()
@@ -105,19 +175,62 @@ func main() {
 		log.Fatal("cannot load tls credentials: ", err)
 	}
 
-	interceptor := service.NewAuthInterceptor(jwtManager, accessibleRoles())
+	policy := accessPolicy()
+	if *policyFile != "" {
+		policy, err = service.LoadAccessPolicy(*policyFile)
+		if err != nil {
+			log.Fatal("cannot load access policy: ", err)
+		}
+	}
+
+	interceptor, err := service.NewAuthInterceptor(jwtManager, revocationStore, apiKeyStore, policy)
+	if err != nil {
+		log.Fatal("cannot create auth interceptor: ", err)
+	}
+
+	authServer.PolicyProvider = interceptor
+	laptopServer.PolicyProvider = interceptor
+	apiKeyServer.PolicyProvider = interceptor
+	userServer.PolicyProvider = interceptor
+	interceptor.UserStore = userStore
+	interceptor.AuditStore = auditStore
+
+	if *policyFile != "" {
+		stopWatching := interceptor.WatchPolicyFile(*policyFile, policyReloadInterval)
+		defer stopWatching()
+	}
+
+	logging := interceptors.NewLoggingServerInterceptor(interceptors.LoggingOptions{
+		Level:      requestLogLevel,
+		SampleRate: *logSampleRate,
+	})
+
+	chain := interceptors.NewServerChain()
+	err = chain.Use(logging, interceptors.All)
+	if err != nil {
+		log.Fatal("cannot add logging interceptor: ", err)
+	}
+
+	err = chain.Use(interceptor, interceptors.Selector{Exclude: tokenIssuingMethods})
+	if err != nil {
+		log.Fatal("cannot add auth interceptor: ", err)
+	}
 
-	grpcServer := grpc.NewServer(
-		grpc.Creds(tlsCredentials),
-		grpc.UnaryInterceptor(interceptor.Unary()),
-		grpc.StreamInterceptor(interceptor.Stream()),
-	)
+	grpcServer := grpc.NewServer(append([]grpc.ServerOption{grpc.Creds(tlsCredentials)}, chain.ServerOptions()...)...)
 
 	pb.RegisterAuthServiceServer(grpcServer, authServer)
+	pb.RegisterUserServiceServer(grpcServer, userServer)
+	pb.RegisterAPIKeyServiceServer(grpcServer, apiKeyServer)
+	pb.RegisterAuditServiceServer(grpcServer, auditServer)
 	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
 
 	reflection.Register(grpcServer)
 
+	err = interceptor.ValidateServer(grpcServer)
+	if err != nil {
+		log.Fatal("cannot validate access policy: ", err)
+	}
+
 	address := fmt.Sprintf("127.0.0.1:%d", *port)
 	listener, err := net.Listen("tcp", address)
 	if err != nil {
@@ -0,0 +1,121 @@
+package interceptors
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+//recordingInterceptor records its name in the calls it runs for
+type recordingInterceptor struct {
+	name  string
+	calls *[]string
+}
+
+func (interceptor recordingInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		*interceptor.calls = append(*interceptor.calls, interceptor.name)
+		return handler(ctx, req)
+	}
+}
+
+func (interceptor recordingInterceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		*interceptor.calls = append(*interceptor.calls, interceptor.name)
+		return handler(srv, ss)
+	}
+}
+
+func TestSelector(t *testing.T) {
+	t.Parallel()
+
+	selector := Selector{
+		Include: []string{"/pb.AuthService/*", "/pb.LaptopService/*"},
+		Exclude: []string{"/pb.AuthService/Login"},
+	}
+	require.NoError(t, selector.Validate())
+	require.True(t, selector.Matches("/pb.AuthService/Logout"))
+	require.True(t, selector.Matches("/pb.LaptopService/CreateLaptop"))
+	require.False(t, selector.Matches("/pb.AuthService/Login"))
+	require.False(t, selector.Matches("/pb.UserService/ListUsers"))
+
+	require.True(t, All.Matches("/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"))
+	require.False(t, Selector{Exclude: []string{"/grpc.reflection.*/*"}}.Matches("/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"))
+
+	require.Error(t, Selector{Exclude: []string{"/pb.AuthService/["}}.Validate())
+	require.Error(t, NewServerChain().Use(recordingInterceptor{}, Selector{Include: []string{"["}}))
+}
+
+func TestServerChain(t *testing.T) {
+	t.Parallel()
+
+	var calls []string
+	chain := NewServerChain()
+	require.NoError(t, chain.Use(recordingInterceptor{"logging", &calls}, All))
+	require.NoError(t, chain.Use(recordingInterceptor{"auth", &calls}, Selector{Exclude: []string{"/pb.AuthService/Login"}}))
+	require.NoError(t, chain.UseUnary(recordingInterceptor{"unary", &calls}.Unary(), Selector{Include: []string{"/pb.LaptopService/*"}}))
+	require.Len(t, chain.ServerOptions(), 2)
+
+	unary := func(method string) []string {
+		calls = nil
+		res, err := chain.Unary()(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			calls = append(calls, "handler")
+			return req, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, "req", res)
+		return calls
+	}
+
+	require.Equal(t, []string{"logging", "auth", "unary", "handler"}, unary("/pb.LaptopService/CreateLaptop"))
+	require.Equal(t, []string{"logging", "handler"}, unary("/pb.AuthService/Login"))
+	require.Equal(t, []string{"logging", "auth", "handler"}, unary("/pb.AuthService/Logout"))
+
+	calls = nil
+	err := chain.Stream()(nil, nil, &grpc.StreamServerInfo{FullMethod: "/pb.LaptopService/RateLaptop"}, func(srv interface{}, ss grpc.ServerStream) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"logging", "auth", "handler"}, calls)
+}
+
+func TestClientChain(t *testing.T) {
+	t.Parallel()
+
+	var calls []string
+	record := func(name string) grpc.UnaryClientInterceptor {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			calls = append(calls, name)
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+	}
+
+	chain := NewClientChain()
+	require.NoError(t, chain.UseUnary(record("first"), All))
+	require.NoError(t, chain.UseUnary(record("second"), Selector{Exclude: []string{"/pb.AuthService/*"}}))
+	require.Len(t, chain.DialOptions(), 2)
+
+	invoke := func(method string) []string {
+		calls = nil
+		err := chain.Unary()(context.Background(), method, nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			calls = append(calls, "invoker")
+			return nil
+		})
+		require.NoError(t, err)
+		return calls
+	}
+
+	require.Equal(t, []string{"first", "second", "invoker"}, invoke("/pb.LaptopService/SearchLaptop"))
+	require.Equal(t, []string{"first", "invoker"}, invoke("/pb.AuthService/Login"))
+
+	calls = nil
+	_, err := chain.Stream()(context.Background(), &grpc.StreamDesc{}, nil, "/pb.LaptopService/RateLaptop", func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		calls = append(calls, "streamer")
+		return nil, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"streamer"}, calls)
+}
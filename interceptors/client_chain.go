@@ -0,0 +1,120 @@
+package interceptors
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+//ClientInterceptor provides the unary and the stream interceptor of a concern such as the authentication
+type ClientInterceptor interface {
+	Unary() grpc.UnaryClientInterceptor
+	Stream() grpc.StreamClientInterceptor
+}
+
+//ClientChain runs the client interceptors in the order they were added, each for the methods of its selector
+type ClientChain struct {
+	unary  []selectedUnaryClientInterceptor
+	stream []selectedStreamClientInterceptor
+}
+
+type selectedUnaryClientInterceptor struct {
+	interceptor grpc.UnaryClientInterceptor
+	selector    Selector
+}
+
+type selectedStreamClientInterceptor struct {
+	interceptor grpc.StreamClientInterceptor
+	selector    Selector
+}
+
+//NewClientChain returns an empty ClientChain
+func NewClientChain() *ClientChain {
+	return &ClientChain{}
+}
+
+//Use adds both the unary and the stream interceptor so they keep the same position in the two chains
+func (chain *ClientChain) Use(interceptor ClientInterceptor, selector Selector) error {
+	err := selector.Validate()
+	if err != nil {
+		return err
+	}
+
+	chain.unary = append(chain.unary, selectedUnaryClientInterceptor{interceptor.Unary(), selector})
+	chain.stream = append(chain.stream, selectedStreamClientInterceptor{interceptor.Stream(), selector})
+	return nil
+}
+
+//UseUnary adds an interceptor of the unary RPCs only
+func (chain *ClientChain) UseUnary(interceptor grpc.UnaryClientInterceptor, selector Selector) error {
+	err := selector.Validate()
+	if err != nil {
+		return err
+	}
+
+	chain.unary = append(chain.unary, selectedUnaryClientInterceptor{interceptor, selector})
+	return nil
+}
+
+//UseStream adds an interceptor of the stream RPCs only
+func (chain *ClientChain) UseStream(interceptor grpc.StreamClientInterceptor, selector Selector) error {
+	err := selector.Validate()
+	if err != nil {
+		return err
+	}
+
+	chain.stream = append(chain.stream, selectedStreamClientInterceptor{interceptor, selector})
+	return nil
+}
+
+//DialOptions returns the options installing the chain on a client connection
+func (chain *ClientChain) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithUnaryInterceptor(chain.Unary()),
+		grpc.WithStreamInterceptor(chain.Stream()),
+	}
+}
+
+//Unary returns a single interceptor running the unary interceptors of the chain
+func (chain *ClientChain) Unary() grpc.UnaryClientInterceptor {
+	interceptors := append([]selectedUnaryClientInterceptor(nil), chain.unary...)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return runUnaryClient(ctx, interceptors, method, req, reply, cc, invoker, opts...)
+	}
+}
+
+//Stream returns a single interceptor running the stream interceptors of the chain
+func (chain *ClientChain) Stream() grpc.StreamClientInterceptor {
+	interceptors := append([]selectedStreamClientInterceptor(nil), chain.stream...)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return runStreamClient(ctx, interceptors, desc, cc, method, streamer, opts...)
+	}
+}
+
+func runUnaryClient(ctx context.Context, interceptors []selectedUnaryClientInterceptor, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	for len(interceptors) > 0 && !interceptors[0].selector.Matches(method) {
+		interceptors = interceptors[1:]
+	}
+
+	if len(interceptors) == 0 {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+
+	return interceptors[0].interceptor(ctx, method, req, reply, cc, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return runUnaryClient(ctx, interceptors[1:], method, req, reply, cc, invoker, opts...)
+	}, opts...)
+}
+
+func runStreamClient(ctx context.Context, interceptors []selectedStreamClientInterceptor, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	for len(interceptors) > 0 && !interceptors[0].selector.Matches(method) {
+		interceptors = interceptors[1:]
+	}
+
+	if len(interceptors) == 0 {
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+
+	return interceptors[0].interceptor(ctx, desc, cc, method, func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return runStreamClient(ctx, interceptors[1:], desc, cc, method, streamer, opts...)
+	}, opts...)
+}
@@ -0,0 +1,435 @@
+package interceptors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+//Level is the severity of a log line
+type Level int
+
+//the levels of the log lines, from the least to the most severe
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+//String returns the name of the level
+func (level Level) String() string {
+	name, ok := levelNames[level]
+	if !ok {
+		return fmt.Sprintf("level(%d)", int(level))
+	}
+
+	return name
+}
+
+//ParseLevel returns the level of the name, one of debug, info, warn and error
+func ParseLevel(name string) (Level, error) {
+	for level, other := range levelNames {
+		if strings.EqualFold(name, other) {
+			return level, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+//DefaultCodeLevel logs successful RPCs at info, the errors caused by the caller at warn and the other errors at error
+func DefaultCodeLevel(code codes.Code) Level {
+	switch code {
+	case codes.OK:
+		return LevelInfo
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.PermissionDenied,
+		codes.ResourceExhausted, codes.FailedPrecondition, codes.OutOfRange, codes.Unauthenticated:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
+
+//LoggingOptions configures the logging interceptors, Output defaults to the standard error,
+//the lines below Level are dropped, CodeLevel picks the level of a RPC from its status code and
+//defaults to DefaultCodeLevel, and SampleRate is the fraction of the lines below LevelWarn written,
+//zero like one writes every line so the zero value logs everything, raise Level to LevelWarn to
+//drop all the lines below it
+type LoggingOptions struct {
+	Output     io.Writer
+	Level      Level
+	CodeLevel  func(code codes.Code) Level
+	SampleRate float64
+}
+
+//rpcLog is the JSON line written for every RPC
+type rpcLog struct {
+	Time             string  `json:"time"`
+	Level            string  `json:"level"`
+	Side             string  `json:"side"`
+	Method           string  `json:"method"`
+	Kind             string  `json:"kind"`
+	Peer             string  `json:"peer,omitempty"`
+	User             string  `json:"user,omitempty"`
+	Event            string  `json:"event,omitempty"`
+	Code             string  `json:"code"`
+	Error            string  `json:"error,omitempty"`
+	LatencyMs        float64 `json:"latency_ms"`
+	RequestBytes     int     `json:"request_bytes"`
+	ResponseBytes    int     `json:"response_bytes"`
+	MessagesReceived int     `json:"messages_received,omitempty"`
+	MessagesSent     int     `json:"messages_sent,omitempty"`
+}
+
+//rpcRecord collects the fields of the log line while the RPC runs
+type rpcRecord struct {
+	mutex         sync.Mutex
+	line          rpcLog
+	start         time.Time
+	receivedBytes int
+	sentBytes     int
+}
+
+type rpcRecordKey struct{}
+
+//SetUser records the user of the RPC in the log line of the server logging interceptor, it does
+//nothing when the RPC is not logged
+func SetUser(ctx context.Context, user string) {
+	record, ok := ctx.Value(rpcRecordKey{}).(*rpcRecord)
+	if !ok {
+		return
+	}
+
+	record.mutex.Lock()
+	record.line.User = user
+	record.mutex.Unlock()
+}
+
+//SetEvent records what the handler did in the log line of the server logging interceptor, the events
+//of the same RPC are joined, a line with an event is never sampled out, it does nothing when the RPC
+//is not logged
+func SetEvent(ctx context.Context, event string) {
+	record, ok := ctx.Value(rpcRecordKey{}).(*rpcRecord)
+	if !ok {
+		return
+	}
+
+	record.mutex.Lock()
+	defer record.mutex.Unlock()
+
+	if record.line.Event != "" {
+		event = record.line.Event + "; " + event
+	}
+
+	record.line.Event = event
+}
+
+//logWriter writes the log lines of the options
+type logWriter struct {
+	options LoggingOptions
+	mutex   sync.Mutex
+}
+
+func newLogWriter(options LoggingOptions) *logWriter {
+	if options.Output == nil {
+		options.Output = os.Stderr
+	}
+
+	if options.CodeLevel == nil {
+		options.CodeLevel = DefaultCodeLevel
+	}
+
+	return &logWriter{
+		options: options,
+	}
+}
+
+func newRPCRecord(side string, method string, kind string, peer string) *rpcRecord {
+	return &rpcRecord{
+		start: time.Now(),
+		line: rpcLog{
+			Side:   side,
+			Method: method,
+			Kind:   kind,
+			Peer:   peer,
+		},
+	}
+}
+
+func (record *rpcRecord) received(m interface{}) {
+	record.mutex.Lock()
+	defer record.mutex.Unlock()
+
+	record.line.MessagesReceived++
+	record.receivedBytes += messageSize(m)
+}
+
+func (record *rpcRecord) sent(m interface{}) {
+	record.mutex.Lock()
+	defer record.mutex.Unlock()
+
+	record.line.MessagesSent++
+	record.sentBytes += messageSize(m)
+}
+
+//write finishes the record with the error of the RPC and writes it unless it is filtered out
+func (writer *logWriter) write(record *rpcRecord, err error) {
+	st := status.Convert(err)
+	level := writer.options.CodeLevel(st.Code())
+	if level < writer.options.Level {
+		return
+	}
+
+	record.mutex.Lock()
+	line := record.line
+	line.RequestBytes, line.ResponseBytes = record.receivedBytes, record.sentBytes
+	if line.Side == "client" {
+		line.RequestBytes, line.ResponseBytes = record.sentBytes, record.receivedBytes
+	}
+	record.mutex.Unlock()
+
+	rate := writer.options.SampleRate
+	if line.Event == "" && level < LevelWarn && rate > 0 && rate < 1 && rand.Float64() >= rate {
+		return
+	}
+
+	line.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	line.Level = level.String()
+	line.Code = st.Code().String()
+	line.LatencyMs = float64(time.Since(record.start).Microseconds()) / 1000
+	if err != nil {
+		line.Error = st.Message()
+	}
+
+	data, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	writer.options.Output.Write(append(data, '\n'))
+}
+
+//LoggingServerInterceptor writes one JSON line per RPC served
+type LoggingServerInterceptor struct {
+	writer *logWriter
+}
+
+//NewLoggingServerInterceptor is the constructor, add it first to the chain so that it also logs the
+//RPCs the other interceptors reject
+func NewLoggingServerInterceptor(options LoggingOptions) *LoggingServerInterceptor {
+	return &LoggingServerInterceptor{
+		writer: newLogWriter(options),
+	}
+}
+
+//Unary returns a server interceptor logging the unary rpc
+func (interceptor *LoggingServerInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		record := newRPCRecord("server", info.FullMethod, "unary", peerAddress(ctx))
+		record.received(req)
+
+		res, err := handler(context.WithValue(ctx, rpcRecordKey{}, record), req)
+		if err == nil {
+			record.sent(res)
+		}
+
+		interceptor.writer.write(record, err)
+		return res, err
+	}
+}
+
+//Stream returns a server interceptor logging the stream rpc with the messages it carried
+func (interceptor *LoggingServerInterceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		record := newRPCRecord("server", info.FullMethod, streamKind(info.IsClientStream, info.IsServerStream), peerAddress(ss.Context()))
+		err := handler(srv, &loggingServerStream{
+			ServerStream: ss,
+			ctx:          context.WithValue(ss.Context(), rpcRecordKey{}, record),
+			record:       record,
+		})
+
+		interceptor.writer.write(record, err)
+		return err
+	}
+}
+
+//loggingServerStream counts the messages of the stream
+type loggingServerStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	record *rpcRecord
+}
+
+func (stream *loggingServerStream) Context() context.Context {
+	return stream.ctx
+}
+
+func (stream *loggingServerStream) SendMsg(m interface{}) error {
+	err := stream.ServerStream.SendMsg(m)
+	if err == nil {
+		stream.record.sent(m)
+	}
+
+	return err
+}
+
+func (stream *loggingServerStream) RecvMsg(m interface{}) error {
+	err := stream.ServerStream.RecvMsg(m)
+	if err == nil {
+		stream.record.received(m)
+	}
+
+	return err
+}
+
+//LoggingClientInterceptor writes one JSON line per RPC called, the request is what the client sent
+//and the response what it received
+type LoggingClientInterceptor struct {
+	writer *logWriter
+}
+
+//NewLoggingClientInterceptor is the constructor
+func NewLoggingClientInterceptor(options LoggingOptions) *LoggingClientInterceptor {
+	return &LoggingClientInterceptor{
+		writer: newLogWriter(options),
+	}
+}
+
+//Unary returns a client interceptor logging the unary rpc
+func (interceptor *LoggingClientInterceptor) Unary() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		record := newRPCRecord("client", method, "unary", clientTarget(cc))
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		//the client sends the request and receives the reply
+		record.sent(req)
+		if err == nil {
+			record.received(reply)
+		}
+
+		interceptor.writer.write(record, err)
+		return err
+	}
+}
+
+//Stream returns a client interceptor logging the stream rpc once it ends, which is when the client
+//receives its last message or an error
+func (interceptor *LoggingClientInterceptor) Stream() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		record := newRPCRecord("client", method, streamKind(desc.ClientStreams, desc.ServerStreams), clientTarget(cc))
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			interceptor.writer.write(record, err)
+			return nil, err
+		}
+
+		return &loggingClientStream{
+			ClientStream: stream,
+			writer:       interceptor.writer,
+			record:       record,
+			serverStream: desc.ServerStreams,
+		}, nil
+	}
+}
+
+//loggingClientStream counts the messages of the stream and writes the log line when it ends
+type loggingClientStream struct {
+	grpc.ClientStream
+	writer       *logWriter
+	record       *rpcRecord
+	serverStream bool
+	once         sync.Once
+}
+
+func (stream *loggingClientStream) SendMsg(m interface{}) error {
+	err := stream.ClientStream.SendMsg(m)
+	if err == nil {
+		stream.record.sent(m)
+	}
+
+	return err
+}
+
+func (stream *loggingClientStream) RecvMsg(m interface{}) error {
+	err := stream.ClientStream.RecvMsg(m)
+	switch {
+	case err == io.EOF:
+		stream.finish(nil)
+	case err != nil:
+		stream.finish(err)
+	default:
+		stream.record.received(m)
+		if !stream.serverStream {
+			//the only response of a client stream ends it
+			stream.finish(nil)
+		}
+	}
+
+	return err
+}
+
+func (stream *loggingClientStream) finish(err error) {
+	stream.once.Do(func() {
+		stream.writer.write(stream.record, err)
+	})
+}
+
+func streamKind(clientStream bool, serverStream bool) string {
+	switch {
+	case clientStream && serverStream:
+		return "bidi_stream"
+	case clientStream:
+		return "client_stream"
+	default:
+		return "server_stream"
+	}
+}
+
+func peerAddress(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	return p.Addr.String()
+}
+
+func clientTarget(cc *grpc.ClientConn) string {
+	if cc == nil {
+		return ""
+	}
+
+	return cc.Target()
+}
+
+func messageSize(m interface{}) int {
+	message, ok := m.(proto.Message)
+	if !ok {
+		return 0
+	}
+
+	return proto.Size(message)
+}
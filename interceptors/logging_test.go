@@ -0,0 +1,197 @@
+package interceptors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/niroopreddym/interceptors-grpc-go/pb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+//fakeServerStream receives the requests and drops the responses
+type fakeServerStream struct {
+	grpc.ServerStream
+	requests []*pb.RateLaptopRequest
+}
+
+func (stream *fakeServerStream) Context() context.Context {
+	return context.Background()
+}
+
+func (stream *fakeServerStream) RecvMsg(m interface{}) error {
+	if len(stream.requests) == 0 {
+		return io.EOF
+	}
+
+	proto.Merge(m.(proto.Message), stream.requests[0])
+	stream.requests = stream.requests[1:]
+	return nil
+}
+
+func (stream *fakeServerStream) SendMsg(m interface{}) error {
+	return nil
+}
+
+func readLogLines(t *testing.T, output *bytes.Buffer) []rpcLog {
+	var lines []rpcLog
+	for _, data := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		if data == "" {
+			continue
+		}
+
+		var line rpcLog
+		require.NoError(t, json.Unmarshal([]byte(data), &line))
+		lines = append(lines, line)
+	}
+
+	output.Reset()
+	return lines
+}
+
+func TestLoggingServerInterceptorUnary(t *testing.T) {
+	t.Parallel()
+
+	output := &bytes.Buffer{}
+	interceptor := NewLoggingServerInterceptor(LoggingOptions{Output: output, Level: LevelInfo})
+	req := &pb.LoginRequest{Username: "user1", Password: "secret"}
+	res := &pb.LoginResponse{AccessToken: "token"}
+	info := &grpc.UnaryServerInfo{FullMethod: "/pb.AuthService/Login"}
+
+	_, err := interceptor.Unary()(context.Background(), req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		SetUser(ctx, "user1")
+		SetEvent(ctx, "rehashed the password of user user1")
+		SetEvent(ctx, "user user1 logged in")
+		return res, nil
+	})
+	require.NoError(t, err)
+
+	lines := readLogLines(t, output)
+	require.Len(t, lines, 1)
+	require.Equal(t, "info", lines[0].Level)
+	require.Equal(t, "server", lines[0].Side)
+	require.Equal(t, "/pb.AuthService/Login", lines[0].Method)
+	require.Equal(t, "unary", lines[0].Kind)
+	require.Equal(t, "user1", lines[0].User)
+	require.Equal(t, "rehashed the password of user user1; user user1 logged in", lines[0].Event)
+	require.Equal(t, "OK", lines[0].Code)
+	require.Equal(t, proto.Size(req), lines[0].RequestBytes)
+	require.Equal(t, proto.Size(res), lines[0].ResponseBytes)
+
+	_, err = interceptor.Unary()(context.Background(), req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Errorf(codes.NotFound, "incorrect username/password")
+	})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	lines = readLogLines(t, output)
+	require.Len(t, lines, 1)
+	require.Equal(t, "warn", lines[0].Level)
+	require.Equal(t, "NotFound", lines[0].Code)
+	require.Equal(t, "incorrect username/password", lines[0].Error)
+	require.Empty(t, lines[0].User)
+	require.Empty(t, lines[0].Event)
+}
+
+func TestLoggingServerInterceptorStream(t *testing.T) {
+	t.Parallel()
+
+	output := &bytes.Buffer{}
+	interceptor := NewLoggingServerInterceptor(LoggingOptions{Output: output})
+	requests := []*pb.RateLaptopRequest{{LaptopId: "laptop-1", Score: 5}, {LaptopId: "laptop-2", Score: 7}}
+	info := &grpc.StreamServerInfo{FullMethod: "/pb.LaptopService/RateLaptop", IsClientStream: true, IsServerStream: true}
+
+	err := interceptor.Stream()(nil, &fakeServerStream{requests: requests}, info, func(srv interface{}, ss grpc.ServerStream) error {
+		for {
+			req := &pb.RateLaptopRequest{}
+			err := ss.RecvMsg(req)
+			if err == io.EOF {
+				return nil
+			}
+
+			err = ss.SendMsg(&pb.RateLaptopResponse{LaptopId: req.GetLaptopId(), RatedCount: 1})
+			if err != nil {
+				return err
+			}
+		}
+	})
+	require.NoError(t, err)
+
+	lines := readLogLines(t, output)
+	require.Len(t, lines, 1)
+	require.Equal(t, "bidi_stream", lines[0].Kind)
+	require.Equal(t, 2, lines[0].MessagesReceived)
+	require.Equal(t, 2, lines[0].MessagesSent)
+	require.Equal(t, proto.Size(requests[0])+proto.Size(requests[1]), lines[0].RequestBytes)
+}
+
+func TestLoggingLevelsAndSampling(t *testing.T) {
+	t.Parallel()
+
+	output := &bytes.Buffer{}
+	info := &grpc.UnaryServerInfo{FullMethod: "/pb.LaptopService/CreateLaptop"}
+	call := func(interceptor *LoggingServerInterceptor, err error) {
+		interceptor.Unary()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, err
+		})
+	}
+
+	warnOnly := NewLoggingServerInterceptor(LoggingOptions{Output: output, Level: LevelWarn})
+	call(warnOnly, nil)
+	call(warnOnly, status.Errorf(codes.Internal, "cannot save laptop"))
+	lines := readLogLines(t, output)
+	require.Len(t, lines, 1)
+	require.Equal(t, "error", lines[0].Level)
+
+	//the sampling keeps every warning and error
+	sampled := NewLoggingServerInterceptor(LoggingOptions{Output: output, SampleRate: 1e-9})
+	for i := 0; i < 100; i++ {
+		call(sampled, nil)
+	}
+	call(sampled, status.Errorf(codes.PermissionDenied, "no permission"))
+	lines = readLogLines(t, output)
+	require.Len(t, lines, 1)
+	require.Equal(t, "PermissionDenied", lines[0].Code)
+
+	//nor the lines recording an event
+	sampled.Unary()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		SetEvent(ctx, "created laptop")
+		return nil, nil
+	})
+	lines = readLogLines(t, output)
+	require.Len(t, lines, 1)
+	require.Equal(t, "created laptop", lines[0].Event)
+
+	level, err := ParseLevel("WARN")
+	require.NoError(t, err)
+	require.Equal(t, LevelWarn, level)
+	_, err = ParseLevel("verbose")
+	require.Error(t, err)
+}
+
+func TestLoggingClientInterceptor(t *testing.T) {
+	t.Parallel()
+
+	output := &bytes.Buffer{}
+	interceptor := NewLoggingClientInterceptor(LoggingOptions{Output: output})
+	req := &pb.LoginRequest{Username: "user1", Password: "secret"}
+	reply := &pb.LoginResponse{}
+
+	err := interceptor.Unary()(context.Background(), "/pb.AuthService/Login", req, reply, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		reply.(*pb.LoginResponse).AccessToken = "token"
+		return nil
+	})
+	require.NoError(t, err)
+
+	lines := readLogLines(t, output)
+	require.Len(t, lines, 1)
+	require.Equal(t, "client", lines[0].Side)
+	require.Equal(t, proto.Size(req), lines[0].RequestBytes)
+	require.Equal(t, proto.Size(reply), lines[0].ResponseBytes)
+}
@@ -0,0 +1,51 @@
+package interceptors
+
+import (
+	"fmt"
+	"path"
+)
+
+//Selector chooses the methods an interceptor runs for by the path.Match patterns of their full method names
+//such as /pb.AuthService/* or /grpc.reflection.*/*, an empty Include selects every method and a method
+//matched by Exclude is skipped even when Include matches it
+type Selector struct {
+	Include []string
+	Exclude []string
+}
+
+//All selects every method
+var All = Selector{}
+
+//Validate checks the patterns of the selector
+func (selector Selector) Validate() error {
+	for _, patterns := range [][]string{selector.Include, selector.Exclude} {
+		for _, pattern := range patterns {
+			_, err := path.Match(pattern, "")
+			if err != nil {
+				return fmt.Errorf("invalid method pattern %q: %w", pattern, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+//Matches tells whether the interceptor runs for the full method name
+func (selector Selector) Matches(method string) bool {
+	if matchAny(selector.Exclude, method) {
+		return false
+	}
+
+	return len(selector.Include) == 0 || matchAny(selector.Include, method)
+}
+
+func matchAny(patterns []string, method string) bool {
+	for _, pattern := range patterns {
+		matched, err := path.Match(pattern, method)
+		if err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,120 @@
+package interceptors
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+//ServerInterceptor provides the unary and the stream interceptor of a concern such as the authentication
+type ServerInterceptor interface {
+	Unary() grpc.UnaryServerInterceptor
+	Stream() grpc.StreamServerInterceptor
+}
+
+//ServerChain runs the server interceptors in the order they were added, each for the methods of its selector
+type ServerChain struct {
+	unary  []selectedUnaryServerInterceptor
+	stream []selectedStreamServerInterceptor
+}
+
+type selectedUnaryServerInterceptor struct {
+	interceptor grpc.UnaryServerInterceptor
+	selector    Selector
+}
+
+type selectedStreamServerInterceptor struct {
+	interceptor grpc.StreamServerInterceptor
+	selector    Selector
+}
+
+//NewServerChain returns an empty ServerChain
+func NewServerChain() *ServerChain {
+	return &ServerChain{}
+}
+
+//Use adds both the unary and the stream interceptor so they keep the same position in the two chains
+func (chain *ServerChain) Use(interceptor ServerInterceptor, selector Selector) error {
+	err := selector.Validate()
+	if err != nil {
+		return err
+	}
+
+	chain.unary = append(chain.unary, selectedUnaryServerInterceptor{interceptor.Unary(), selector})
+	chain.stream = append(chain.stream, selectedStreamServerInterceptor{interceptor.Stream(), selector})
+	return nil
+}
+
+//UseUnary adds an interceptor of the unary RPCs only
+func (chain *ServerChain) UseUnary(interceptor grpc.UnaryServerInterceptor, selector Selector) error {
+	err := selector.Validate()
+	if err != nil {
+		return err
+	}
+
+	chain.unary = append(chain.unary, selectedUnaryServerInterceptor{interceptor, selector})
+	return nil
+}
+
+//UseStream adds an interceptor of the stream RPCs only
+func (chain *ServerChain) UseStream(interceptor grpc.StreamServerInterceptor, selector Selector) error {
+	err := selector.Validate()
+	if err != nil {
+		return err
+	}
+
+	chain.stream = append(chain.stream, selectedStreamServerInterceptor{interceptor, selector})
+	return nil
+}
+
+//ServerOptions returns the options installing the chain on a grpc server
+func (chain *ServerChain) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(chain.Unary()),
+		grpc.StreamInterceptor(chain.Stream()),
+	}
+}
+
+//Unary returns a single interceptor running the unary interceptors of the chain
+func (chain *ServerChain) Unary() grpc.UnaryServerInterceptor {
+	interceptors := append([]selectedUnaryServerInterceptor(nil), chain.unary...)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return runUnaryServer(ctx, interceptors, req, info, handler)
+	}
+}
+
+//Stream returns a single interceptor running the stream interceptors of the chain
+func (chain *ServerChain) Stream() grpc.StreamServerInterceptor {
+	interceptors := append([]selectedStreamServerInterceptor(nil), chain.stream...)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return runStreamServer(interceptors, srv, ss, info, handler)
+	}
+}
+
+func runUnaryServer(ctx context.Context, interceptors []selectedUnaryServerInterceptor, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	for len(interceptors) > 0 && !interceptors[0].selector.Matches(info.FullMethod) {
+		interceptors = interceptors[1:]
+	}
+
+	if len(interceptors) == 0 {
+		return handler(ctx, req)
+	}
+
+	return interceptors[0].interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return runUnaryServer(ctx, interceptors[1:], req, info, handler)
+	})
+}
+
+func runStreamServer(interceptors []selectedStreamServerInterceptor, srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	for len(interceptors) > 0 && !interceptors[0].selector.Matches(info.FullMethod) {
+		interceptors = interceptors[1:]
+	}
+
+	if len(interceptors) == 0 {
+		return handler(srv, ss)
+	}
+
+	return interceptors[0].interceptor(srv, ss, info, func(srv interface{}, ss grpc.ServerStream) error {
+		return runStreamServer(interceptors[1:], srv, ss, info, handler)
+	})
+}
@@ -0,0 +1,258 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.27.1
+// 	protoc        v3.17.3
+// source: auth_options.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	descriptorpb "google.golang.org/protobuf/types/descriptorpb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Authn is the credential the caller must authenticate with
+type AuthRule_Authn int32
+
+const (
+	AuthRule_JWT  AuthRule_Authn = 0
+	AuthRule_CERT AuthRule_Authn = 1
+	AuthRule_BOTH AuthRule_Authn = 2
+)
+
+// Enum value maps for AuthRule_Authn.
+var (
+	AuthRule_Authn_name = map[int32]string{
+		0: "JWT",
+		1: "CERT",
+		2: "BOTH",
+	}
+	AuthRule_Authn_value = map[string]int32{
+		"JWT":  0,
+		"CERT": 1,
+		"BOTH": 2,
+	}
+)
+
+func (x AuthRule_Authn) Enum() *AuthRule_Authn {
+	p := new(AuthRule_Authn)
+	*p = x
+	return p
+}
+
+func (x AuthRule_Authn) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (AuthRule_Authn) Descriptor() protoreflect.EnumDescriptor {
+	return file_auth_options_proto_enumTypes[0].Descriptor()
+}
+
+func (AuthRule_Authn) Type() protoreflect.EnumType {
+	return &file_auth_options_proto_enumTypes[0]
+}
+
+func (x AuthRule_Authn) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use AuthRule_Authn.Descriptor instead.
+func (AuthRule_Authn) EnumDescriptor() ([]byte, []int) {
+	return file_auth_options_proto_rawDescGZIP(), []int{0, 0}
+}
+
+// AuthRule declares who may call a RPC, a rule without roles and permissions
+// lets every authenticated caller access the RPC
+type AuthRule struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Public      bool           `protobuf:"varint,1,opt,name=public,proto3" json:"public,omitempty"`
+	Roles       []string       `protobuf:"bytes,2,rep,name=roles,proto3" json:"roles,omitempty"`
+	Permissions []string       `protobuf:"bytes,3,rep,name=permissions,proto3" json:"permissions,omitempty"`
+	Authn       AuthRule_Authn `protobuf:"varint,4,opt,name=authn,proto3,enum=pb.AuthRule_Authn" json:"authn,omitempty"`
+}
+
+func (x *AuthRule) Reset() {
+	*x = AuthRule{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_auth_options_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *AuthRule) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuthRule) ProtoMessage() {}
+
+func (x *AuthRule) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_options_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuthRule.ProtoReflect.Descriptor instead.
+func (*AuthRule) Descriptor() ([]byte, []int) {
+	return file_auth_options_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *AuthRule) GetPublic() bool {
+	if x != nil {
+		return x.Public
+	}
+	return false
+}
+
+func (x *AuthRule) GetRoles() []string {
+	if x != nil {
+		return x.Roles
+	}
+	return nil
+}
+
+func (x *AuthRule) GetPermissions() []string {
+	if x != nil {
+		return x.Permissions
+	}
+	return nil
+}
+
+func (x *AuthRule) GetAuthn() AuthRule_Authn {
+	if x != nil {
+		return x.Authn
+	}
+	return AuthRule_JWT
+}
+
+var file_auth_options_proto_extTypes = []protoimpl.ExtensionInfo{
+	{
+		ExtendedType:  (*descriptorpb.MethodOptions)(nil),
+		ExtensionType: (*AuthRule)(nil),
+		Field:         50001,
+		Name:          "pb.auth",
+		Tag:           "bytes,50001,opt,name=auth",
+		Filename:      "auth_options.proto",
+	},
+}
+
+// Extension fields to descriptorpb.MethodOptions.
+var (
+	// optional pb.AuthRule auth = 50001;
+	E_Auth = &file_auth_options_proto_extTypes[0]
+)
+
+var File_auth_options_proto protoreflect.FileDescriptor
+
+var file_auth_options_proto_rawDesc = []byte{
+	0x0a, 0x12, 0x61, 0x75, 0x74, 0x68, 0x5f, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x12, 0x02, 0x70, 0x62, 0x1a, 0x20, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
+	0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69,
+	0x70, 0x74, 0x6f, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xaa, 0x01, 0x0a, 0x08, 0x41,
+	0x75, 0x74, 0x68, 0x52, 0x75, 0x6c, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x70, 0x75, 0x62, 0x6c, 0x69,
+	0x63, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x12,
+	0x14, 0x0a, 0x05, 0x72, 0x6f, 0x6c, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x05,
+	0x72, 0x6f, 0x6c, 0x65, 0x73, 0x12, 0x20, 0x0a, 0x0b, 0x70, 0x65, 0x72, 0x6d, 0x69, 0x73, 0x73,
+	0x69, 0x6f, 0x6e, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0b, 0x70, 0x65, 0x72, 0x6d,
+	0x69, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x28, 0x0a, 0x05, 0x61, 0x75, 0x74, 0x68, 0x6e,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x12, 0x2e, 0x70, 0x62, 0x2e, 0x41, 0x75, 0x74, 0x68,
+	0x52, 0x75, 0x6c, 0x65, 0x2e, 0x41, 0x75, 0x74, 0x68, 0x6e, 0x52, 0x05, 0x61, 0x75, 0x74, 0x68,
+	0x6e, 0x22, 0x24, 0x0a, 0x05, 0x41, 0x75, 0x74, 0x68, 0x6e, 0x12, 0x07, 0x0a, 0x03, 0x4a, 0x57,
+	0x54, 0x10, 0x00, 0x12, 0x08, 0x0a, 0x04, 0x43, 0x45, 0x52, 0x54, 0x10, 0x01, 0x12, 0x08, 0x0a,
+	0x04, 0x42, 0x4f, 0x54, 0x48, 0x10, 0x02, 0x3a, 0x42, 0x0a, 0x04, 0x61, 0x75, 0x74, 0x68, 0x12,
+	0x1e, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
+	0x66, 0x2e, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18,
+	0xd1, 0x86, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x70, 0x62, 0x2e, 0x41, 0x75, 0x74,
+	0x68, 0x52, 0x75, 0x6c, 0x65, 0x52, 0x04, 0x61, 0x75, 0x74, 0x68, 0x42, 0x06, 0x5a, 0x04, 0x2e,
+	0x2f, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_auth_options_proto_rawDescOnce sync.Once
+	file_auth_options_proto_rawDescData = file_auth_options_proto_rawDesc
+)
+
+func file_auth_options_proto_rawDescGZIP() []byte {
+	file_auth_options_proto_rawDescOnce.Do(func() {
+		file_auth_options_proto_rawDescData = protoimpl.X.CompressGZIP(file_auth_options_proto_rawDescData)
+	})
+	return file_auth_options_proto_rawDescData
+}
+
+var file_auth_options_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_auth_options_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_auth_options_proto_goTypes = []interface{}{
+	(AuthRule_Authn)(0),                // 0: pb.AuthRule.Authn
+	(*AuthRule)(nil),                   // 1: pb.AuthRule
+	(*descriptorpb.MethodOptions)(nil), // 2: google.protobuf.MethodOptions
+}
+var file_auth_options_proto_depIdxs = []int32{
+	0, // 0: pb.AuthRule.authn:type_name -> pb.AuthRule.Authn
+	2, // 1: pb.auth:extendee -> google.protobuf.MethodOptions
+	1, // 2: pb.auth:type_name -> pb.AuthRule
+	3, // [3:3] is the sub-list for method output_type
+	3, // [3:3] is the sub-list for method input_type
+	2, // [2:3] is the sub-list for extension type_name
+	1, // [1:2] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_auth_options_proto_init() }
+func file_auth_options_proto_init() {
+	if File_auth_options_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_auth_options_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AuthRule); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_auth_options_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   1,
+			NumExtensions: 1,
+			NumServices:   0,
+		},
+		GoTypes:           file_auth_options_proto_goTypes,
+		DependencyIndexes: file_auth_options_proto_depIdxs,
+		EnumInfos:         file_auth_options_proto_enumTypes,
+		MessageInfos:      file_auth_options_proto_msgTypes,
+		ExtensionInfos:    file_auth_options_proto_extTypes,
+	}.Build()
+	File_auth_options_proto = out.File
+	file_auth_options_proto_rawDesc = nil
+	file_auth_options_proto_goTypes = nil
+	file_auth_options_proto_depIdxs = nil
+}
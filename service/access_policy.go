@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//the credentials a rule can require the caller to authenticate with
+const (
+	AuthnJWT  = "jwt"
+	AuthnCert = "cert"
+	AuthnBoth = "both"
+)
+
+//AccessRule grants access to the methods matching the Method pattern, a rule without
+//roles and permissions lets every authenticated caller access the methods and a
+//public rule lets every caller access them without a token, though a token or API key
+//presented to a public method is still verified to resolve the identity of the caller,
+//Authn is the credential the caller authenticates with and defaults to the access token
+type AccessRule struct {
+	Method      string   `json:"method" yaml:"method"`
+	Public      bool     `json:"public,omitempty" yaml:"public,omitempty"`
+	Authn       string   `json:"authn,omitempty" yaml:"authn,omitempty"`
+	Roles       []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+}
+
+//CertIdentity maps the verified client certificates whose subject common name or one of
+//whose subject alternative names matches the Subject pattern to a principal with the roles,
+//the principal defaults to the matched name
+type CertIdentity struct {
+	Subject   string   `json:"subject" yaml:"subject"`
+	Principal string   `json:"principal,omitempty" yaml:"principal,omitempty"`
+	Roles     []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	Tenant    string   `json:"tenant,omitempty" yaml:"tenant,omitempty"`
+}
+
+//AccessPolicy maps roles to the permissions they grant and methods to the roles or permissions allowed to call them,
+//method patterns and granted permissions use the path.Match syntax such as /pb.LaptopService/* or laptop:*,
+//with ProtoRules the (pb.auth) options of the RPCs apply to the methods no rule matches,
+//methods matched by no rule are open to everyone unless DefaultDeny is set,
+//CertIdentities are tried in order to find the identity of a client certificate
+type AccessPolicy struct {
+	DefaultDeny     bool                `json:"default_deny,omitempty" yaml:"default_deny,omitempty"`
+	ProtoRules      bool                `json:"proto_rules,omitempty" yaml:"proto_rules,omitempty"`
+	RolePermissions map[string][]string `json:"role_permissions" yaml:"role_permissions"`
+	Rules           []AccessRule        `json:"rules" yaml:"rules"`
+	CertIdentities  []CertIdentity      `json:"cert_identities,omitempty" yaml:"cert_identities,omitempty"`
+}
+
+//PolicyProvider provides the access policy currently enforced
+type PolicyProvider interface {
+	Policy() *AccessPolicy
+}
+
+//Validate checks that the method patterns and the granted permissions are well formed
+func (policy *AccessPolicy) Validate() error {
+	for _, rule := range policy.Rules {
+		if rule.Method == "" {
+			return fmt.Errorf("rule has no method")
+		}
+
+		_, err := path.Match(rule.Method, "")
+		if err != nil {
+			return fmt.Errorf("invalid method pattern %q: %w", rule.Method, err)
+		}
+
+		switch rule.Authn {
+		case "", AuthnJWT, AuthnCert, AuthnBoth:
+		default:
+			return fmt.Errorf("invalid authn %q of rule %q", rule.Authn, rule.Method)
+		}
+	}
+
+	for _, identity := range policy.CertIdentities {
+		_, err := path.Match(identity.Subject, "")
+		if identity.Subject == "" || err != nil {
+			return fmt.Errorf("invalid certificate subject pattern %q", identity.Subject)
+		}
+	}
+
+	for role, permissions := range policy.RolePermissions {
+		for _, permission := range permissions {
+			_, err := path.Match(permission, "")
+			if err != nil {
+				return fmt.Errorf("invalid permission %q of role %s: %w", permission, role, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+//ValidateMethods checks that every rule matches at least one of the full method names
+func (policy *AccessPolicy) ValidateMethods(methods []string) error {
+	for _, rule := range policy.Rules {
+		found := false
+		for _, method := range methods {
+			matched, err := path.Match(rule.Method, method)
+			if rule.Method == method || (err == nil && matched) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("rule %q does not match any registered method", rule.Method)
+		}
+	}
+
+	return nil
+}
+
+//rule returns the rule matching the method, an exact rule wins over patterns and a longer
+//literal prefix wins over a shorter one, nil is returned when no rule matches
+func (policy *AccessPolicy) rule(method string) *AccessRule {
+	rule := matchRule(policy.Rules, method)
+	if rule == nil && policy.ProtoRules {
+		rule = matchRule(ProtoAccessRules(), method)
+	}
+
+	return rule
+}
+
+func matchRule(rules []AccessRule, method string) *AccessRule {
+	var best *AccessRule
+	bestPrefix := -1
+
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Method == method {
+			return rule
+		}
+
+		matched, err := path.Match(rule.Method, method)
+		if err != nil || !matched {
+			continue
+		}
+
+		prefix := strings.IndexAny(rule.Method, `*?[\`)
+		if prefix > bestPrefix {
+			best = rule
+			bestPrefix = prefix
+		}
+	}
+
+	return best
+}
+
+//Permissions returns the permissions granted by the roles
+func (policy *AccessPolicy) Permissions(roles []string) []string {
+	var permissions []string
+	for _, role := range roles {
+		permissions = append(permissions, policy.RolePermissions[role]...)
+	}
+
+	return permissions
+}
+
+//allows checks whether a caller with the roles satisfies the rule
+func (policy *AccessPolicy) allows(rule *AccessRule, roles []string) bool {
+	if len(rule.Roles) == 0 && len(rule.Permissions) == 0 {
+		return true
+	}
+
+	for _, role := range roles {
+		for _, allowed := range rule.Roles {
+			if role == allowed {
+				return true
+			}
+		}
+	}
+
+	for _, granted := range policy.Permissions(roles) {
+		for _, required := range rule.Permissions {
+			if matchPermission(granted, required) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+//allowsScopes checks whether a token limited to the scopes satisfies the rule,
+//only rules requiring a permission covered by one of the scopes are satisfied
+func allowsScopes(rule *AccessRule, scopes []string) bool {
+	for _, scope := range scopes {
+		for _, required := range rule.Permissions {
+			if matchPermission(scope, required) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+//coversScopes checks that every scope is covered by one of the granted permissions
+func coversScopes(granted []string, scopes []string) bool {
+	for _, scope := range scopes {
+		covered := false
+		for _, permission := range granted {
+			if matchPermission(permission, scope) {
+				covered = true
+				break
+			}
+		}
+
+		if !covered {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchPermission(granted string, required string) bool {
+	matched, err := path.Match(granted, required)
+	return err == nil && matched
+}
+
+//checkGrantableRole checks that the role is defined by the access policy and that the caller holds
+//every permission of the role, so that callers cannot grant more than they have themselves
+func checkGrantableRole(ctx context.Context, policyProvider PolicyProvider, role string) error {
+	if policyProvider == nil {
+		return status.Errorf(codes.FailedPrecondition, "roles cannot be checked without an access policy")
+	}
+
+	policy := policyProvider.Policy()
+	permissions, ok := policy.RolePermissions[role]
+	if !ok {
+		return status.Errorf(codes.InvalidArgument, "role %s is not defined by the access policy", role)
+	}
+
+	identity, ok := IdentityFromContext(ctx)
+	if !ok || !coversScopes(policy.Permissions(identity.Roles), permissions) {
+		return status.Errorf(codes.PermissionDenied, "role %s exceeds the permissions of the caller", role)
+	}
+
+	if identity.Claims != nil && identity.Claims.Scoped() && !coversScopes(identity.Claims.Scopes, permissions) {
+		return status.Errorf(codes.PermissionDenied, "role %s exceeds the scopes of the access token", role)
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy := &AccessPolicy{
+		RolePermissions: map[string][]string{
+			"admin":  {"laptop:*"},
+			"editor": {"laptop:write"},
+		},
+		Rules: []AccessRule{
+			{Method: "/pb.LaptopService/*", Roles: []string{"admin"}},
+			{Method: "/pb.LaptopService/Create*", Permissions: []string{"laptop:write"}},
+			{Method: "/pb.LaptopService/SearchLaptop"},
+		},
+	}
+	require.NoError(t, policy.Validate())
+
+	testCases := []struct {
+		name    string
+		method  string
+		roles   []string
+		found   bool
+		allowed bool
+	}{
+		{name: "no_rule", method: "/pb.AuthService/Login", found: false},
+		{name: "exact_authenticated", method: "/pb.LaptopService/SearchLaptop", roles: []string{"user"}, found: true, allowed: true},
+		{name: "longest_pattern_permission", method: "/pb.LaptopService/CreateLaptop", roles: []string{"editor"}, found: true, allowed: true},
+		{name: "wildcard_permission", method: "/pb.LaptopService/CreateLaptop", roles: []string{"admin"}, found: true, allowed: true},
+		{name: "pattern_role", method: "/pb.LaptopService/UploadImage", roles: []string{"admin"}, found: true, allowed: true},
+		{name: "pattern_denied", method: "/pb.LaptopService/UploadImage", roles: []string{"user", "editor"}, found: true, allowed: false},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			rule := policy.rule(tc.method)
+			require.Equal(t, tc.found, rule != nil)
+			if rule != nil {
+				require.Equal(t, tc.allowed, policy.allows(rule, tc.roles))
+			}
+		})
+	}
+
+	invalid := &AccessPolicy{Rules: []AccessRule{{Method: "/pb.LaptopService/["}}}
+	require.Error(t, invalid.Validate())
+}
+
+func TestProtoAccessRules(t *testing.T) {
+	t.Parallel()
+
+	policy := &AccessPolicy{
+		ProtoRules: true,
+		Rules:      []AccessRule{{Method: "/pb.LaptopService/RateLaptop", Roles: []string{"admin"}}},
+	}
+
+	rule := policy.rule("/pb.LaptopService/CreateLaptop")
+	require.NotNil(t, rule)
+	require.Equal(t, []string{"laptop:write"}, rule.Permissions)
+
+	rule = policy.rule("/pb.AuthService/Login")
+	require.NotNil(t, rule)
+	require.True(t, rule.Public)
+
+	rule = policy.rule("/pb.AuthService/Logout")
+	require.NotNil(t, rule)
+	require.False(t, rule.Public)
+	require.Empty(t, rule.Roles)
+	require.Empty(t, rule.Permissions)
+
+	//explicit rules win over the proto options
+	rule = policy.rule("/pb.LaptopService/RateLaptop")
+	require.Equal(t, []string{"admin"}, rule.Roles)
+}
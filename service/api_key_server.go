@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/niroopreddym/interceptors-grpc-go/interceptors"
+	"github.com/niroopreddym/interceptors-grpc-go/pb"
+	"github.com/niroopreddym/interceptors-grpc-go/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//APIKeyServer implements the RPCs managing the API keys of service callers,
+//PolicyProvider supplies the roles API keys may be created with
+type APIKeyServer struct {
+	PolicyProvider PolicyProvider
+	APIKeyStore    store.APIKeyStore
+}
+
+//NewAPIKeyServer is the constructor for the API key server
+func NewAPIKeyServer(apiKeyStore store.APIKeyStore) *APIKeyServer {
+	return &APIKeyServer{
+		APIKeyStore: apiKeyStore,
+	}
+}
+
+//CreateAPIKey issues a new API key with the role, the key is only returned in the response,
+//the role must be defined by the access policy and the caller must hold all its permissions
+func (server *APIKeyServer) CreateAPIKey(ctx context.Context, req *pb.CreateAPIKeyRequest) (*pb.CreateAPIKeyResponse, error) {
+	if req.GetName() == "" || req.GetRole() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "name and role must be provided")
+	}
+
+	err := checkGrantableRole(ctx, server.PolicyProvider, req.GetRole())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var expiresAt time.Time
+	if req.GetExpiresAt() != nil {
+		err = req.GetExpiresAt().CheckValid()
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "expiry is invalid: %v", err)
+		}
+
+		expiresAt = req.GetExpiresAt().AsTime()
+		if !expiresAt.After(now) {
+			return nil, status.Errorf(codes.InvalidArgument, "expiry must be in the future")
+		}
+	}
+
+	key, err := randomToken()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot generate api key: %v", err)
+	}
+
+	apiKey := &store.APIKey{
+		ID:        uuid.New().String(),
+		Name:      req.GetName(),
+		HashedKey: hashToken(key),
+		Role:      req.GetRole(),
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+
+	if identity, ok := IdentityFromContext(ctx); ok {
+		apiKey.CreatedBy = identity.Principal
+		apiKey.Tenant = identity.Tenant
+	}
+
+	err = server.APIKeyStore.Save(apiKey)
+	if err != nil {
+		return nil, storeError(err, "cannot save api key")
+	}
+
+	interceptors.SetEvent(ctx, fmt.Sprintf("created api key %s (%s) with role %s", apiKey.ID, apiKey.Name, apiKey.Role))
+	res := &pb.CreateAPIKeyResponse{
+		ApiKey: toPBAPIKey(apiKey),
+		Key:    key,
+	}
+
+	return res, nil
+}
+
+//ListAPIKeys lists the issued API keys without the keys themselves
+func (server *APIKeyServer) ListAPIKeys(ctx context.Context, req *pb.ListAPIKeysRequest) (*pb.ListAPIKeysResponse, error) {
+	apiKeys, err := server.APIKeyStore.List()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot list api keys: %v", err)
+	}
+
+	res := &pb.ListAPIKeysResponse{}
+	for _, apiKey := range apiKeys {
+		res.ApiKeys = append(res.ApiKeys, toPBAPIKey(apiKey))
+	}
+
+	return res, nil
+}
+
+//RevokeAPIKey deletes an API key so it is no longer accepted
+func (server *APIKeyServer) RevokeAPIKey(ctx context.Context, req *pb.RevokeAPIKeyRequest) (*pb.RevokeAPIKeyResponse, error) {
+	err := server.APIKeyStore.Delete(req.GetId())
+	if err != nil {
+		return nil, storeError(err, "cannot revoke api key")
+	}
+
+	interceptors.SetEvent(ctx, fmt.Sprintf("revoked api key %s", req.GetId()))
+	return &pb.RevokeAPIKeyResponse{}, nil
+}
+
+func toPBAPIKey(apiKey *store.APIKey) *pb.APIKey {
+	res := &pb.APIKey{
+		Id:        apiKey.ID,
+		Name:      apiKey.Name,
+		Role:      apiKey.Role,
+		CreatedBy: apiKey.CreatedBy,
+		CreatedAt: timestamppb.New(apiKey.CreatedAt),
+	}
+
+	if !apiKey.ExpiresAt.IsZero() {
+		res.ExpiresAt = timestamppb.New(apiKey.ExpiresAt)
+	}
+
+	if !apiKey.LastUsedAt.IsZero() {
+		res.LastUsedAt = timestamppb.New(apiKey.LastUsedAt)
+	}
+
+	return res
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/niroopreddym/interceptors-grpc-go/pb"
+	"github.com/niroopreddym/interceptors-grpc-go/store"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestServerAPIKeys(t *testing.T) {
+	t.Parallel()
+
+	apiKeyStore := store.NewInMemoryAPIKeyStore()
+	server := NewAPIKeyServer(apiKeyStore)
+	interceptor, err := NewAuthInterceptor(NewJWTManager("secret", time.Minute), store.NewInMemoryRevocationStore(), apiKeyStore, &AccessPolicy{
+		RolePermissions: map[string][]string{
+			"admin":     {"apikey:*", "laptop:*"},
+			"batch":     {"laptop:write"},
+			"keymaster": {"apikey:*"},
+		},
+		Rules: []AccessRule{
+			{Method: "/pb.LaptopService/CreateLaptop", Permissions: []string{"laptop:write"}},
+			{Method: "/pb.LaptopService/RateLaptop", Permissions: []string{"rating:write"}},
+		},
+	})
+	require.NoError(t, err)
+
+	server.PolicyProvider = interceptor
+	adminCtx := contextWithIdentity(context.Background(), &Identity{Principal: "admin1", Roles: []string{"admin"}})
+	created, err := server.CreateAPIKey(adminCtx, &pb.CreateAPIKeyRequest{Name: "nightly import", Role: "batch"})
+	require.NoError(t, err)
+	require.NotEmpty(t, created.GetKey())
+	require.Equal(t, "admin1", created.GetApiKey().GetCreatedBy())
+	require.Nil(t, created.GetApiKey().GetExpiresAt())
+
+	//the role must exist and must not grant more than the caller holds
+	_, err = server.CreateAPIKey(adminCtx, &pb.CreateAPIKeyRequest{Name: "typo", Role: "bacth"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	keymasterCtx := contextWithIdentity(context.Background(), &Identity{Principal: "keymaster1", Roles: []string{"keymaster"}})
+	_, err = server.CreateAPIKey(keymasterCtx, &pb.CreateAPIKeyRequest{Name: "escalation", Role: "admin"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = server.CreateAPIKey(keymasterCtx, &pb.CreateAPIKeyRequest{Name: "nightly export", Role: "batch"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = server.CreateAPIKey(adminCtx, &pb.CreateAPIKeyRequest{Name: "expired", Role: "batch", ExpiresAt: timestamppb.New(time.Now().Add(-time.Minute))})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	authorize := func(key string, method string) (*Identity, error) {
+		return interceptor.authorize(metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", key)), method)
+	}
+
+	identity, err := authorize(created.GetKey(), "/pb.LaptopService/CreateLaptop")
+	require.NoError(t, err)
+	require.Equal(t, created.GetApiKey().GetId(), identity.APIKey.ID)
+	require.Equal(t, []string{"batch"}, identity.Roles)
+
+	_, err = authorize(created.GetKey(), "/pb.LaptopService/RateLaptop")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = authorize("unknown", "/pb.LaptopService/CreateLaptop")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	list, err := server.ListAPIKeys(context.Background(), &pb.ListAPIKeysRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.GetApiKeys(), 1)
+	require.NotNil(t, list.GetApiKeys()[0].GetLastUsedAt())
+
+	//keys past their expiry are rejected
+	expiring, err := server.CreateAPIKey(adminCtx, &pb.CreateAPIKeyRequest{Name: "short lived", Role: "batch", ExpiresAt: timestamppb.New(time.Now().Add(time.Hour))})
+	require.NoError(t, err)
+	_, err = authorize(expiring.GetKey(), "/pb.LaptopService/CreateLaptop")
+	require.NoError(t, err)
+
+	apiKey, err := apiKeyStore.Find(expiring.GetApiKey().GetId())
+	require.NoError(t, err)
+	require.NoError(t, apiKeyStore.Delete(apiKey.ID))
+	apiKey.ExpiresAt = time.Now().Add(-time.Second)
+	require.NoError(t, apiKeyStore.Save(apiKey))
+	_, err = authorize(expiring.GetKey(), "/pb.LaptopService/CreateLaptop")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = server.RevokeAPIKey(context.Background(), &pb.RevokeAPIKeyRequest{Id: created.GetApiKey().GetId()})
+	require.NoError(t, err)
+	_, err = authorize(created.GetKey(), "/pb.LaptopService/CreateLaptop")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = server.RevokeAPIKey(context.Background(), &pb.RevokeAPIKeyRequest{Id: created.GetApiKey().GetId()})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+//revokingAPIKeyStore deletes every key right after it is looked up
+type revokingAPIKeyStore struct {
+	*store.InMemoryAPIKeyStore
+}
+
+func (store revokingAPIKeyStore) FindByHash(hashedKey string) (*store.APIKey, error) {
+	key, err := store.InMemoryAPIKeyStore.FindByHash(hashedKey)
+	if err != nil || key == nil {
+		return key, err
+	}
+
+	return key, store.Delete(key.ID)
+}
+
+func TestAuthInterceptorAPIKeyRevokedDuringLookup(t *testing.T) {
+	t.Parallel()
+
+	apiKeyStore := revokingAPIKeyStore{store.NewInMemoryAPIKeyStore()}
+	require.NoError(t, apiKeyStore.Save(&store.APIKey{ID: "key1", HashedKey: hashToken("secret-key"), Role: "batch"}))
+
+	interceptor, err := NewAuthInterceptor(NewJWTManager("secret", time.Minute), store.NewInMemoryRevocationStore(), apiKeyStore, &AccessPolicy{
+		RolePermissions: map[string][]string{"batch": {"laptop:write"}},
+		Rules:           []AccessRule{{Method: "/pb.LaptopService/CreateLaptop", Permissions: []string{"laptop:write"}}},
+	})
+	require.NoError(t, err)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "secret-key"))
+	_, err = interceptor.authorize(ctx, "/pb.LaptopService/CreateLaptop")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+
+	"github.com/niroopreddym/interceptors-grpc-go/pb"
+	"github.com/niroopreddym/interceptors-grpc-go/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//AuditServer implements the RPC querying the audit log of impersonated calls
+type AuditServer struct {
+	AuditStore store.AuditStore
+}
+
+//NewAuditServer is the constructor for the audit server
+func NewAuditServer(auditStore store.AuditStore) *AuditServer {
+	return &AuditServer{
+		AuditStore: auditStore,
+	}
+}
+
+//QueryAuditLog returns the audit entries matching the request, the most recent first
+func (server *AuditServer) QueryAuditLog(ctx context.Context, req *pb.QueryAuditLogRequest) (*pb.QueryAuditLogResponse, error) {
+	filter := store.AuditFilter{
+		Actor:   req.GetActor(),
+		Subject: req.GetSubject(),
+		Limit:   int(req.GetLimit()),
+	}
+
+	if req.GetSince() != nil {
+		filter.Since = req.GetSince().AsTime()
+	}
+
+	if req.GetUntil() != nil {
+		filter.Until = req.GetUntil().AsTime()
+	}
+
+	entries, err := server.AuditStore.Query(filter)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot query audit log: %v", err)
+	}
+
+	res := &pb.QueryAuditLogResponse{}
+	for _, entry := range entries {
+		res.Entries = append(res.Entries, &pb.AuditEntry{
+			Time:    timestamppb.New(entry.Time),
+			Actor:   entry.Actor,
+			Subject: entry.Subject,
+			Method:  entry.Method,
+			Code:    entry.Code,
+		})
+	}
+
+	return res, nil
+}
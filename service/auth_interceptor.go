@@ -2,79 +2,454 @@ package service
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/niroopreddym/interceptors-grpc-go/interceptors"
+	"github.com/niroopreddym/interceptors-grpc-go/store"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
-//AuthInterceptor grpc middleware
+const (
+	//apiKeyHeader is the metadata key carrying the API key of service callers
+	apiKeyHeader = "x-api-key"
+	//actAsHeader is the metadata key naming the user an admin runs the RPC as
+	actAsHeader = "x-act-as"
+	//impersonatePermission lets a caller run RPCs as another user
+	impersonatePermission = "user:impersonate"
+	//crossTenantPermission lets a caller impersonate the users of other tenants
+	crossTenantPermission = "tenant:cross"
+)
+
+//AuthInterceptor grpc middleware, impersonation with the x-act-as header is only
+//accepted when UserStore and AuditStore are set
 type AuthInterceptor struct {
+	UserStore       store.UserStore
+	AuditStore      store.AuditStore
 	jwtManager      *JWTManager
-	accessibleRoles map[string][]string
+	revocationStore store.RevocationStore
+	apiKeyStore     store.APIKeyStore
+	policy          atomic.Value
+	mutex           sync.Mutex
+	methods         []string
 }
 
-//NewAuthInterceptor construtor
-func NewAuthInterceptor(jwtManager *JWTManager, accessibleRoles map[string][]string) *AuthInterceptor {
-	return &AuthInterceptor{
+//NewAuthInterceptor construtor, API keys are not accepted when apiKeyStore is nil
+func NewAuthInterceptor(jwtManager *JWTManager, revocationStore store.RevocationStore, apiKeyStore store.APIKeyStore, policy *AccessPolicy) (*AuthInterceptor, error) {
+	interceptor := &AuthInterceptor{
 		jwtManager:      jwtManager,
-		accessibleRoles: accessibleRoles,
+		revocationStore: revocationStore,
+		apiKeyStore:     apiKeyStore,
+	}
+
+	err := interceptor.SetPolicy(policy)
+	if err != nil {
+		return nil, err
 	}
+
+	return interceptor, nil
+}
+
+//Policy returns the access policy currently enforced
+func (interceptor *AuthInterceptor) Policy() *AccessPolicy {
+	return interceptor.policy.Load().(*AccessPolicy)
+}
+
+//SetPolicy validates the access policy and atomically replaces the current one with it
+func (interceptor *AuthInterceptor) SetPolicy(policy *AccessPolicy) error {
+	if policy == nil {
+		return fmt.Errorf("access policy must be provided")
+	}
+
+	err := policy.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid access policy: %w", err)
+	}
+
+	interceptor.mutex.Lock()
+	defer interceptor.mutex.Unlock()
+
+	if interceptor.methods != nil {
+		err = policy.ValidateMethods(interceptor.methods)
+		if err != nil {
+			return fmt.Errorf("invalid access policy: %w", err)
+		}
+	}
+
+	interceptor.policy.Store(policy)
+	return nil
+}
+
+//ValidateServer checks every rule of the policy against the methods registered on the server,
+//the policies set afterwards are validated against the same methods
+func (interceptor *AuthInterceptor) ValidateServer(server *grpc.Server) error {
+	var methods []string
+	for serviceName, info := range server.GetServiceInfo() {
+		for _, method := range info.Methods {
+			methods = append(methods, "/"+serviceName+"/"+method.Name)
+		}
+	}
+
+	interceptor.mutex.Lock()
+	defer interceptor.mutex.Unlock()
+
+	err := interceptor.Policy().ValidateMethods(methods)
+	if err != nil {
+		return fmt.Errorf("invalid access policy: %w", err)
+	}
+
+	interceptor.methods = methods
+	return nil
 }
 
 //Unary returns a server intereptor to autheticate the unary rpc
 func (interceptor *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		log.Println("--> unary interceptor: ", info.FullMethod)
-		err := interceptor.authorize(ctx, info.FullMethod)
+		identity, err := interceptor.authorize(ctx, info.FullMethod)
 		if err != nil {
 			return nil, err
 		}
-		return handler(ctx, req)
+
+		ctx = contextWithIdentity(ctx, identity)
+		if identity != nil {
+			interceptors.SetUser(ctx, callerName(ctx))
+		}
+
+		res, err := handler(ctx, req)
+		if identity != nil && identity.Impersonator != nil {
+			auditErr := interceptor.audit(identity.Impersonator, identity.Principal, info.FullMethod, err)
+			if auditErr != nil {
+				return nil, auditErr
+			}
+		}
+
+		return res, err
 	}
 }
 
 //Stream returns a server intereptor to autheticate the stream rpc
 func (interceptor *AuthInterceptor) Stream() grpc.StreamServerInterceptor {
 	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-		log.Println("--> stream interceptor: ", info.FullMethod)
-		err := interceptor.authorize(ss.Context(), info.FullMethod)
+		identity, err := interceptor.authorize(ss.Context(), info.FullMethod)
 		if err != nil {
 			return err
 		}
-		return handler(srv, ss)
+
+		if identity != nil {
+			ss = &serverStream{ServerStream: ss, ctx: contextWithIdentity(ss.Context(), identity)}
+			interceptors.SetUser(ss.Context(), callerName(ss.Context()))
+		}
+
+		err = handler(srv, ss)
+		if identity != nil && identity.Impersonator != nil {
+			auditErr := interceptor.audit(identity.Impersonator, identity.Principal, info.FullMethod, err)
+			if auditErr != nil {
+				return auditErr
+			}
+		}
+
+		return err
 	}
 }
 
-func (interceptor *AuthInterceptor) authorize(ctx context.Context, method string) error {
-	accessibleRoles, ok := interceptor.accessibleRoles[method]
-	if !ok {
+//authorize checks the caller may access the method and returns the identity of the caller,
+//the identity is nil for the methods everyone can access unless the caller presented an access
+//token or API key, which must then be valid, or a mapped client certificate so that the caller
+//only sees the data of its tenant,
+//the x-act-as header is honoured and audited on every method the caller presents credentials to
+func (interceptor *AuthInterceptor) authorize(ctx context.Context, method string) (*Identity, error) {
+	policy := interceptor.Policy()
+	rule := policy.rule(method)
+	if rule == nil {
+		if policy.DefaultDeny {
+			return nil, status.Errorf(codes.PermissionDenied, "%s is not covered by the access policy", method)
+		}
+
 		//everyone can access
-		return nil
+		rule = &AccessRule{Method: method, Public: true}
 	}
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return status.Errorf(codes.Unauthenticated, "metadata is not provided")
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	actAs := md[actAsHeader]
+
+	var identity *Identity
+	var err error
+	if rule.Public {
+		if hasCredentials(ctx) {
+			identity, err = interceptor.callerIdentity(ctx)
+		} else if cert := peerCertificate(ctx); cert != nil {
+			//a mapped client certificate names the caller and its tenant too
+			identity = policy.certIdentity(cert)
+		}
+
+		if identity == nil && err == nil {
+			if len(actAs) > 0 {
+				return nil, status.Errorf(codes.Unauthenticated, "impersonation needs the credentials of the caller")
+			}
+
+			return nil, nil
+		}
+	} else {
+		identity, err = interceptor.authenticate(ctx, policy, rule.Authn)
 	}
 
-	values := md["authorization"]
-	if len(values) == 0 {
-		return status.Errorf(codes.Unauthenticated, "authorization token not provided")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(actAs) > 0 {
+		return interceptor.impersonate(policy, rule, identity, actAs[0], method)
+	}
+
+	if rule.Public {
+		return identity, nil
+	}
+
+	err = checkAccess(policy, rule, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+func checkAccess(policy *AccessPolicy, rule *AccessRule, identity *Identity) error {
+	if !policy.allows(rule, identity.Roles) {
+		return status.Error(codes.PermissionDenied, "no permission to access this RPC")
+	}
+
+	if identity.Claims != nil && identity.Claims.Scoped() && !allowsScopes(rule, identity.Claims.Scopes) {
+		return status.Error(codes.PermissionDenied, "the scopes of the access token do not cover this RPC")
+	}
+
+	return nil
+}
+
+//impersonate authorizes the caller to run the method as the user, a denied attempt is written to
+//the audit log right away while Unary and Stream audit the allowed ones once the handler returns
+func (interceptor *AuthInterceptor) impersonate(policy *AccessPolicy, rule *AccessRule, caller *Identity, userName string, method string) (*Identity, error) {
+	if interceptor.UserStore == nil || interceptor.AuditStore == nil {
+		return nil, status.Errorf(codes.PermissionDenied, "impersonation is not enabled")
+	}
+
+	identity, err := interceptor.actAs(policy, rule, caller, userName)
+	if err != nil {
+		auditErr := interceptor.audit(caller, userName, method, err)
+		if auditErr != nil {
+			return nil, auditErr
+		}
+
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+//audit writes the outcome of the method run by the actor as the subject to the audit log,
+//the call fails when it cannot be audited
+func (interceptor *AuthInterceptor) audit(actor *Identity, subject string, method string, err error) error {
+	auditErr := interceptor.AuditStore.Append(&store.AuditEntry{
+		Time:    time.Now(),
+		Actor:   actor.Principal,
+		Subject: subject,
+		Method:  method,
+		Code:    status.Code(err).String(),
+	})
+	if auditErr != nil {
+		return status.Errorf(codes.Internal, "cannot write audit log: %v", auditErr)
+	}
+
+	return nil
+}
+
+func (interceptor *AuthInterceptor) actAs(policy *AccessPolicy, rule *AccessRule, caller *Identity, userName string) (*Identity, error) {
+	if caller.Claims == nil || caller.Claims.Scoped() || !coversScopes(policy.Permissions(caller.Roles), []string{impersonatePermission}) {
+		return nil, status.Errorf(codes.PermissionDenied, "no permission to impersonate users")
+	}
+
+	user, err := interceptor.UserStore.Find(userName)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find user: %v", err)
+	}
+
+	if user == nil {
+		return nil, status.Errorf(codes.NotFound, "user %s does not exist", userName)
+	}
+
+	if user.Tenant != caller.Tenant && !coversScopes(policy.Permissions(caller.Roles), []string{crossTenantPermission}) {
+		return nil, status.Errorf(codes.PermissionDenied, "no permission to impersonate users of other tenants")
+	}
+
+	identity := &Identity{
+		Principal:    user.UserName,
+		Roles:        user.Roles,
+		Tenant:       user.Tenant,
+		Impersonator: caller,
+	}
+
+	err = checkAccess(policy, rule, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+//authenticate resolves the identity of the caller from the credentials required by authn,
+//an API key is accepted wherever an access token is and with both the token or API key and
+//the client certificate the roles come from the token or API key
+func (interceptor *AuthInterceptor) authenticate(ctx context.Context, policy *AccessPolicy, authn string) (*Identity, error) {
+	var certIdentity *Identity
+	if authn == AuthnCert || authn == AuthnBoth {
+		cert := peerCertificate(ctx)
+		if cert == nil {
+			return nil, status.Errorf(codes.Unauthenticated, "client certificate not provided")
+		}
+
+		certIdentity = policy.certIdentity(cert)
+		if certIdentity == nil {
+			return nil, status.Errorf(codes.Unauthenticated, "client certificate %s is not mapped to an identity", cert.Subject.CommonName)
+		}
+
+		if authn == AuthnCert {
+			return certIdentity, nil
+		}
+	}
+
+	identity, err := interceptor.callerIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if certIdentity != nil {
+		identity.Certificate = certIdentity.Certificate
+	}
+
+	return identity, nil
+}
+
+//callerIdentity resolves the identity from the API key when the x-api-key header is set and from the access token otherwise
+func (interceptor *AuthInterceptor) callerIdentity(ctx context.Context) (*Identity, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md[apiKeyHeader]; len(values) > 0 {
+		apiKey, err := interceptor.verifyAPIKey(values[0])
+		if err != nil {
+			return nil, err
+		}
+
+		identity := &Identity{
+			Principal: "apikey:" + apiKey.ID,
+			Roles:     []string{apiKey.Role},
+			Tenant:    apiKey.Tenant,
+			APIKey:    apiKey,
+		}
+
+		return identity, nil
+	}
+
+	claims, err := interceptor.verifyAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Principal: claims.Username,
+		Roles:     claims.Roles,
+		Tenant:    claims.Tenant,
+		Claims:    claims,
+	}
+
+	return identity, nil
+}
+
+func (interceptor *AuthInterceptor) verifyAPIKey(key string) (*store.APIKey, error) {
+	if interceptor.apiKeyStore == nil {
+		return nil, status.Errorf(codes.Unauthenticated, "api keys are not accepted")
+	}
+
+	apiKey, err := interceptor.apiKeyStore.FindByHash(hashToken(key))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find api key: %v", err)
+	}
+
+	if apiKey == nil {
+		return nil, status.Errorf(codes.Unauthenticated, "api key is invalid")
+	}
+
+	now := time.Now()
+	if !apiKey.ExpiresAt.IsZero() && now.After(apiKey.ExpiresAt) {
+		return nil, status.Errorf(codes.Unauthenticated, "api key has expired")
+	}
+
+	err = interceptor.apiKeyStore.Touch(apiKey.ID, now)
+	if errors.Is(err, store.ErrNotFound) {
+		//the key was deleted after it was looked up
+		return nil, status.Errorf(codes.Unauthenticated, "api key is invalid")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot update api key: %v", err)
+	}
+
+	apiKey.LastUsedAt = now
+	return apiKey, nil
+}
+
+func (interceptor *AuthInterceptor) verifyAccessToken(ctx context.Context) (*UserClaims, error) {
+	accessToken, err := accessTokenFromContext(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	accessToken := values[0]
 	claims, err := interceptor.jwtManager.Verify(accessToken)
 	if err != nil {
-		return status.Errorf(codes.Unauthenticated, "access token is invalid : %w", err)
+		return nil, status.Errorf(codes.Unauthenticated, "access token is invalid : %v", err)
 	}
 
-	for _, role := range accessibleRoles {
-		if role == claims.Role {
-			return nil
+	revoked, err := interceptor.revocationStore.IsRevoked(claims.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot check token revocation: %v", err)
+	}
+
+	if !revoked {
+		revoked, err = interceptor.revocationStore.IsUserRevoked(claims.Username, claims.IssueTime())
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "cannot check token revocation: %v", err)
 		}
 	}
 
-	return status.Error(codes.PermissionDenied, "no permission to access this RPC")
+	if revoked {
+		return nil, status.Errorf(codes.Unauthenticated, "access token has been revoked")
+	}
+
+	if claims.Confirmation != nil && !matchesCertificate(ctx, claims.Confirmation.CertThumbprint) {
+		return nil, status.Errorf(codes.Unauthenticated, "access token is bound to another client certificate")
+	}
+
+	return claims, nil
+}
+
+//hasCredentials tells whether the caller presented an access token or an API key
+func hasCredentials(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return len(md["authorization"]) > 0 || len(md[apiKeyHeader]) > 0
+}
+
+func accessTokenFromContext(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", status.Errorf(codes.Unauthenticated, "metadata is not provided")
+	}
+
+	values := md["authorization"]
+	if len(values) == 0 {
+		return "", status.Errorf(codes.Unauthenticated, "authorization token not provided")
+	}
+
+	return values[0], nil
 }
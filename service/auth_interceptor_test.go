@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/niroopreddym/interceptors-grpc-go/pb"
+	"github.com/niroopreddym/interceptors-grpc-go/store"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthInterceptorValidateServer(t *testing.T) {
+	t.Parallel()
+
+	grpcServer := grpc.NewServer()
+	pb.RegisterLaptopServiceServer(grpcServer, NewLaptopServer(nil, nil, nil))
+
+	interceptor, err := NewAuthInterceptor(NewJWTManager("secret", time.Minute), store.NewInMemoryRevocationStore(), nil, &AccessPolicy{
+		Rules: []AccessRule{{Method: " /pb.LaptopServiceCreateLaptop", Roles: []string{"admin"}}},
+	})
+	require.NoError(t, err)
+	require.Error(t, interceptor.ValidateServer(grpcServer))
+
+	require.NoError(t, interceptor.SetPolicy(&AccessPolicy{
+		DefaultDeny: true,
+		Rules: []AccessRule{
+			{Method: "/pb.LaptopService/CreateLaptop", Roles: []string{"admin"}},
+			{Method: "/pb.LaptopService/Search*", Public: true},
+		},
+	}))
+	require.NoError(t, interceptor.ValidateServer(grpcServer))
+
+	//later policies are checked against the registered methods too
+	err = interceptor.SetPolicy(&AccessPolicy{Rules: []AccessRule{{Method: "/pb.LaptopService/DeleteLaptop"}}})
+	require.Error(t, err)
+
+	_, err = interceptor.authorize(context.Background(), "/pb.LaptopService/SearchLaptop")
+	require.NoError(t, err)
+
+	_, err = interceptor.authorize(context.Background(), "/pb.LaptopService/RateLaptop")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = interceptor.authorize(context.Background(), "/pb.LaptopService/CreateLaptop")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func contextWithCertificate(ctx context.Context, cert *x509.Certificate) context.Context {
+	return peer.NewContext(ctx, &peer.Peer{
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}},
+		},
+	})
+}
+
+func TestAuthInterceptorCertIdentity(t *testing.T) {
+	t.Parallel()
+
+	jwtManager := NewJWTManager("secret", time.Minute)
+	interceptor, err := NewAuthInterceptor(jwtManager, store.NewInMemoryRevocationStore(), nil, &AccessPolicy{
+		RolePermissions: map[string][]string{"user": {"rating:write"}},
+		Rules: []AccessRule{
+			{Method: "/pb.LaptopService/RateLaptop", Authn: AuthnCert, Permissions: []string{"rating:write"}},
+			{Method: "/pb.LaptopService/CreateLaptop", Authn: AuthnBoth},
+			{Method: "/pb.LaptopService/SearchLaptop", Authn: AuthnJWT},
+		},
+		CertIdentities: []CertIdentity{
+			{Subject: "*.pcclient.com", Principal: "pcclient", Roles: []string{"user"}},
+			{Subject: "spiffe://example.org/*", Roles: []string{"user"}},
+			{Subject: "emea.example.org", Principal: "emea-client", Roles: []string{"user"}, Tenant: "emea"},
+		},
+	})
+	require.NoError(t, err)
+
+	mapped := &x509.Certificate{Subject: pkix.Name{CommonName: "*.pcclient.com"}}
+	unmapped := &x509.Certificate{Subject: pkix.Name{CommonName: "other"}}
+	spiffeID, err := url.Parse("spiffe://example.org/billing")
+	require.NoError(t, err)
+	uri := &x509.Certificate{Subject: pkix.Name{CommonName: "other"}, DNSNames: []string{"other.org"}, URIs: []*url.URL{spiffeID}}
+
+	token, err := jwtManager.Generate(&store.User{UserName: "user1", Roles: []string{"admin"}})
+	require.NoError(t, err)
+	tokenCtx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", token))
+
+	identity, err := interceptor.authorize(contextWithCertificate(context.Background(), mapped), "/pb.LaptopService/RateLaptop")
+	require.NoError(t, err)
+	require.Equal(t, "pcclient", identity.Principal)
+	require.Nil(t, identity.Claims)
+
+	identity, err = interceptor.authorize(contextWithCertificate(context.Background(), uri), "/pb.LaptopService/RateLaptop")
+	require.NoError(t, err)
+	require.Equal(t, "spiffe://example.org/billing", identity.Principal)
+
+	_, err = interceptor.authorize(contextWithCertificate(context.Background(), unmapped), "/pb.LaptopService/RateLaptop")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = interceptor.authorize(tokenCtx, "/pb.LaptopService/RateLaptop")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = interceptor.authorize(tokenCtx, "/pb.LaptopService/CreateLaptop")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = interceptor.authorize(contextWithCertificate(context.Background(), mapped), "/pb.LaptopService/CreateLaptop")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	identity, err = interceptor.authorize(contextWithCertificate(tokenCtx, mapped), "/pb.LaptopService/CreateLaptop")
+	require.NoError(t, err)
+	require.Equal(t, "user1", identity.Principal)
+	require.Equal(t, []string{"admin"}, identity.Roles)
+	require.Same(t, mapped, identity.Certificate)
+
+	_, err = interceptor.authorize(contextWithCertificate(context.Background(), mapped), "/pb.LaptopService/SearchLaptop")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	//the methods everyone can access see the tenant of a mapped certificate
+	tenant := &x509.Certificate{Subject: pkix.Name{CommonName: "emea.example.org"}}
+	identity, err = interceptor.authorize(contextWithCertificate(context.Background(), tenant), "/pb.LaptopService/UploadImage")
+	require.NoError(t, err)
+	require.Equal(t, "emea-client", identity.Principal)
+	require.Equal(t, "emea", identity.Tenant)
+
+	identity, err = interceptor.authorize(contextWithCertificate(context.Background(), unmapped), "/pb.LaptopService/UploadImage")
+	require.NoError(t, err)
+	require.Nil(t, identity)
+
+	//the identity reaches the handler
+	unary := interceptor.Unary()
+	_, err = unary(tokenCtx, nil, &grpc.UnaryServerInfo{FullMethod: "/pb.LaptopService/SearchLaptop"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		identity, ok := IdentityFromContext(ctx)
+		require.True(t, ok)
+		require.Equal(t, "user1", identity.Principal)
+		return nil, nil
+	})
+	require.NoError(t, err)
+}
+
+func TestAuthInterceptorImpersonation(t *testing.T) {
+	t.Parallel()
+
+	jwtManager := NewJWTManager("secret", time.Minute)
+	interceptor, err := NewAuthInterceptor(jwtManager, store.NewInMemoryRevocationStore(), nil, &AccessPolicy{
+		RolePermissions: map[string][]string{
+			"admin":      {"user:*", "laptop:*"},
+			"superadmin": {"user:*", "laptop:*", "tenant:cross"},
+		},
+		Rules: []AccessRule{
+			{Method: "/pb.LaptopService/SearchLaptop", Public: true},
+			{Method: "/pb.LaptopService/CreateLaptop", Permissions: []string{"laptop:write"}},
+		},
+	})
+	require.NoError(t, err)
+
+	userStore := store.NewInMemoryUserStore()
+	user, err := store.NewUser(store.NewBcryptHasher(bcrypt.DefaultCost), "user1", "secret", "user")
+	require.NoError(t, err)
+	require.NoError(t, userStore.Save(user))
+
+	adminToken, err := jwtManager.Generate(&store.User{UserName: "admin1", Roles: []string{"admin"}})
+	require.NoError(t, err)
+	userToken, err := jwtManager.Generate(user)
+	require.NoError(t, err)
+
+	actAs := func(token string, userName string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", token, "x-act-as", userName))
+	}
+
+	//impersonation is off until the stores are set
+	_, err = interceptor.authorize(actAs(adminToken, "user1"), "/pb.LaptopService/SearchLaptop")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	auditStore := store.NewInMemoryAuditStore()
+	interceptor.UserStore = userStore
+	interceptor.AuditStore = auditStore
+
+	unary := interceptor.Unary()
+	_, err = unary(actAs(adminToken, "user1"), nil, &grpc.UnaryServerInfo{FullMethod: "/pb.LaptopService/SearchLaptop"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		identity, ok := IdentityFromContext(ctx)
+		require.True(t, ok)
+		require.Equal(t, "user1", identity.Principal)
+		require.Equal(t, []string{"user"}, identity.Roles)
+
+		realIdentity, ok := RealIdentityFromContext(ctx)
+		require.True(t, ok)
+		require.Equal(t, "admin1", realIdentity.Principal)
+		require.Equal(t, "admin1 (as user1)", callerName(ctx))
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	//the audit log records how the handler answered
+	_, err = unary(actAs(adminToken, "user1"), nil, &grpc.UnaryServerInfo{FullMethod: "/pb.LaptopService/SearchLaptop"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Errorf(codes.Unavailable, "search is down")
+	})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	//the rules apply to the impersonated user
+	_, err = interceptor.authorize(actAs(adminToken, "user1"), "/pb.LaptopService/CreateLaptop")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	//the header needs the credentials of the caller even on public methods
+	anonymous := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-act-as", "user1"))
+	_, err = interceptor.authorize(anonymous, "/pb.LaptopService/SearchLaptop")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = interceptor.authorize(actAs(adminToken, "unknown"), "/pb.LaptopService/SearchLaptop")
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = interceptor.authorize(actAs(userToken, "admin1"), "/pb.LaptopService/SearchLaptop")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	res, err := NewAuditServer(auditStore).QueryAuditLog(context.Background(), &pb.QueryAuditLogRequest{Actor: "admin1"})
+	require.NoError(t, err)
+	require.Len(t, res.GetEntries(), 4)
+	require.Equal(t, "NotFound", res.GetEntries()[0].GetCode())
+	require.Equal(t, "PermissionDenied", res.GetEntries()[1].GetCode())
+	require.Equal(t, "Unavailable", res.GetEntries()[2].GetCode())
+	require.Equal(t, "OK", res.GetEntries()[3].GetCode())
+	require.Equal(t, "/pb.LaptopService/SearchLaptop", res.GetEntries()[3].GetMethod())
+
+	res, err = NewAuditServer(auditStore).QueryAuditLog(context.Background(), &pb.QueryAuditLogRequest{Subject: "admin1", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, res.GetEntries(), 1)
+	require.Equal(t, "user1", res.GetEntries()[0].GetActor())
+
+	//the users of other tenants need the cross tenant permission
+	tenantUser, err := store.NewUser(store.NewBcryptHasher(bcrypt.DefaultCost), "user2", "secret", "user")
+	require.NoError(t, err)
+	tenantUser.Tenant = "emea"
+	require.NoError(t, userStore.Save(tenantUser))
+
+	_, err = interceptor.authorize(actAs(adminToken, "user2"), "/pb.LaptopService/SearchLaptop")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	superadminToken, err := jwtManager.Generate(&store.User{UserName: "superadmin1", Roles: []string{"superadmin"}})
+	require.NoError(t, err)
+	identity, err := interceptor.authorize(actAs(superadminToken, "user2"), "/pb.LaptopService/SearchLaptop")
+	require.NoError(t, err)
+	require.Equal(t, "emea", identity.Tenant)
+}
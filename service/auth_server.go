@@ -2,46 +2,525 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/niroopreddym/interceptors-grpc-go/interceptors"
 	"github.com/niroopreddym/interceptors-grpc-go/pb"
 	"github.com/niroopreddym/interceptors-grpc-go/store"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-//AuthServer auth server implements the authentication validation
+//defaultDelegatedTokenDuration is the lifetime of delegated tokens requested without a ttl
+const defaultDelegatedTokenDuration = 5 * time.Minute
+
+//defaultTOTPIssuer names the service in the authenticator apps of enrolled users
+const defaultTOTPIssuer = "laptop-store"
+
+var (
+	errTOTPEnabled     = errors.New("two-factor authentication is already enabled")
+	errTOTPNotEnrolled = errors.New("two-factor enrolment has not started")
+	errPasswordChanged = errors.New("password changed")
+)
+
+//AuthServer auth server implements the authentication validation,
+//with BindTokens the tokens issued to a client presenting a certificate are bound to that certificate,
+//PolicyProvider supplies the permissions delegated tokens are checked against,
+//TOTPIssuer names the service in the otpauth URIs of the two-factor enrolment and
+//passwords stored with other parameters than PasswordHasher uses are rehashed at login
 type AuthServer struct {
-	UserStore  store.UserStore
-	jwtmanager *JWTManager
+	BindTokens           bool
+	PolicyProvider       PolicyProvider
+	TOTPIssuer           string
+	PasswordHasher       store.PasswordHasher
+	UserStore            store.UserStore
+	RefreshTokenStore    store.RefreshTokenStore
+	RevocationStore      store.RevocationStore
+	LoginLimiter         *LoginLimiter
+	jwtmanager           *JWTManager
+	refreshTokenDuration time.Duration
+	dummyUser            *store.User
 }
 
 //NewAuthServer constructor for the new auth server
-func NewAuthServer(userStore store.UserStore, jwtmanager *JWTManager) *AuthServer {
+func NewAuthServer(userStore store.UserStore, jwtmanager *JWTManager, passwordHasher store.PasswordHasher, refreshTokenStore store.RefreshTokenStore, revocationStore store.RevocationStore, loginLimiter *LoginLimiter, refreshTokenDuration time.Duration) *AuthServer {
+	//the password check of unknown users runs against this user so that it costs as much as
+	//the one of existing users, a hasher with invalid parameters fails the login of every user
+	dummyUser, err := store.NewUser(passwordHasher, "", uuid.New().String())
+	if err != nil {
+		log.Printf("cannot hash the password of the dummy user: %v", err)
+		dummyUser = &store.User{}
+	}
+
 	return &AuthServer{
-		jwtmanager: jwtmanager,
-		UserStore:  userStore,
+		jwtmanager:           jwtmanager,
+		PasswordHasher:       passwordHasher,
+		UserStore:            userStore,
+		RefreshTokenStore:    refreshTokenStore,
+		RevocationStore:      revocationStore,
+		LoginLimiter:         loginLimiter,
+		refreshTokenDuration: refreshTokenDuration,
+		dummyUser:            dummyUser,
+		TOTPIssuer:           defaultTOTPIssuer,
 	}
 }
 
-//Login logs the user into the system via unary RPC
+//Login logs the user into the system via unary RPC, users enrolled in two-factor authentication
+//also present a one-time code, repeated failures for the same username or from the same peer
+//address are throttled and eventually locked out
 func (server *AuthServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
+	limiterKeys := []string{userLimiterKey(req.GetUsername()), peerLimiterKey(ctx)}
+	release, wait := server.LoginLimiter.Begin(limiterKeys...)
+	defer release()
+	if wait > 0 {
+		return nil, retryError(wait)
+	}
+
 	user, err := server.UserStore.Find(req.GetUsername())
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "cannot find user : %v", err)
 	}
 
+	if user == nil {
+		//do the same work as for a wrong password so the timing does not reveal which usernames exist
+		server.dummyUser.IsCorrectPassword(req.GetPassword())
+	}
+
 	if user == nil || !user.IsCorrectPassword(req.GetPassword()) {
+		server.LoginLimiter.Fail(limiterKeys...)
 		return nil, status.Errorf(codes.NotFound, "incorrect username/password")
 	}
 
-	token, err := server.jwtmanager.Generate(user)
+	if user.TOTPEnabled {
+		if req.GetOneTimeCode() == "" {
+			return nil, status.Errorf(codes.Unauthenticated, "one-time code is required")
+		}
+
+		ok, err := server.useOneTimeCode(user.UserName, req.GetOneTimeCode(), false)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			server.LoginLimiter.Fail(limiterKeys...)
+			return nil, status.Errorf(codes.Unauthenticated, "incorrect one-time code")
+		}
+	}
+
+	server.LoginLimiter.Unlock(userLimiterKey(user.UserName))
+	server.rehashPassword(ctx, user, req.GetPassword())
+
+	var certThumbprint string
+	if cert := peerCertificate(ctx); server.BindTokens && cert != nil {
+		certThumbprint = CertThumbprint(cert)
+	}
+
+	token, err := server.jwtmanager.GenerateBound(user, certThumbprint)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "cannot generate access token")
 	}
 
+	refreshToken, err := server.generateRefreshToken(user, uuid.New().String(), certThumbprint)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot generate refresh token: %v", err)
+	}
+
 	res := &pb.LoginResponse{
+		AccessToken:  token,
+		RefreshToken: refreshToken,
+	}
+
+	return res, nil
+}
+
+//RefreshToken exchanges a refresh token for a new access token and a new refresh token,
+//presenting an already exchanged refresh token revokes every token rotated from the same login,
+//a refresh token bound to a client certificate is only exchanged over a connection with that certificate
+func (server *AuthServer) RefreshToken(ctx context.Context, req *pb.RefreshTokenRequest) (*pb.RefreshTokenResponse, error) {
+	tokenID := hashToken(req.GetRefreshToken())
+	refreshToken, err := server.RefreshTokenStore.Find(tokenID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find refresh token: %v", err)
+	}
+
+	//checked before the token is used so a stolen token cannot invalidate the family of its owner
+	if refreshToken != nil && !matchesCertificate(ctx, refreshToken.CertThumbprint) {
+		return nil, status.Errorf(codes.Unauthenticated, "refresh token is bound to another client certificate")
+	}
+
+	refreshToken, err = server.RefreshTokenStore.Use(tokenID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find refresh token: %v", err)
+	}
+
+	if refreshToken == nil || time.Now().After(refreshToken.ExpiresAt) {
+		return nil, status.Errorf(codes.Unauthenticated, "refresh token is invalid or expired")
+	}
+
+	if refreshToken.Used {
+		interceptors.SetEvent(ctx, fmt.Sprintf("refresh token reused for user %s, revoking token family %s", refreshToken.UserName, refreshToken.Family))
+		err := server.RefreshTokenStore.RevokeFamily(refreshToken.Family)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "cannot revoke refresh tokens: %v", err)
+		}
+
+		return nil, status.Errorf(codes.Unauthenticated, "refresh token has already been used")
+	}
+
+	user, err := server.UserStore.Find(refreshToken.UserName)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find user : %v", err)
+	}
+
+	if user == nil {
+		return nil, status.Errorf(codes.Unauthenticated, "user %s no longer exists", refreshToken.UserName)
+	}
+
+	token, err := server.jwtmanager.GenerateBound(user, refreshToken.CertThumbprint)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot generate access token")
+	}
+
+	nextRefreshToken, err := server.generateRefreshToken(user, refreshToken.Family, refreshToken.CertThumbprint)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot generate refresh token: %v", err)
+	}
+
+	res := &pb.RefreshTokenResponse{
+		AccessToken:  token,
+		RefreshToken: nextRefreshToken,
+	}
+
+	return res, nil
+}
+
+//Logout revokes the access token of the caller and the refresh tokens rotated from the same login
+func (server *AuthServer) Logout(ctx context.Context, req *pb.LogoutRequest) (*pb.LogoutResponse, error) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "logout needs the access token of the caller")
+	}
+
+	err := server.revokeAccessToken(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetRefreshToken() != "" {
+		err = server.revokeRefreshToken(req.GetRefreshToken(), claims.Username)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	interceptors.SetEvent(ctx, fmt.Sprintf("user %s logged out", claims.Username))
+	return &pb.LogoutResponse{}, nil
+}
+
+//RevokeToken revokes the given access token and the refresh tokens rotated from the same login
+func (server *AuthServer) RevokeToken(ctx context.Context, req *pb.RevokeTokenRequest) (*pb.RevokeTokenResponse, error) {
+	if req.GetAccessToken() == "" && req.GetRefreshToken() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "access token or refresh token must be provided")
+	}
+
+	if req.GetAccessToken() != "" {
+		claims, err := server.jwtmanager.Verify(req.GetAccessToken())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "access token is invalid : %v", err)
+		}
+
+		err = server.revokeAccessToken(claims)
+		if err != nil {
+			return nil, err
+		}
+
+		interceptors.SetEvent(ctx, fmt.Sprintf("revoked access token %s of user %s", claims.Id, claims.Username))
+	}
+
+	if req.GetRefreshToken() != "" {
+		err := server.revokeRefreshToken(req.GetRefreshToken(), "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &pb.RevokeTokenResponse{}, nil
+}
+
+//CreateDelegatedToken issues a short lived access token for the caller limited to a subset of
+//the caller's permissions, delegated tokens cannot be refreshed
+func (server *AuthServer) CreateDelegatedToken(ctx context.Context, req *pb.CreateDelegatedTokenRequest) (*pb.CreateDelegatedTokenResponse, error) {
+	if len(req.GetScopes()) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "scopes must be provided")
+	}
+
+	duration := defaultDelegatedTokenDuration
+	if req.GetTtl() != nil {
+		err := req.GetTtl().CheckValid()
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "ttl is invalid: %v", err)
+		}
+
+		duration = req.GetTtl().AsDuration()
+		if duration <= 0 || duration > server.jwtmanager.tokenDuration {
+			return nil, status.Errorf(codes.InvalidArgument, "ttl must be positive and at most %v", server.jwtmanager.tokenDuration)
+		}
+	}
+
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "delegated tokens can only be created with an access token")
+	}
+
+	user, err := server.UserStore.Find(claims.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find user : %v", err)
+	}
+
+	if user == nil {
+		return nil, status.Errorf(codes.Unauthenticated, "user %s no longer exists", claims.Username)
+	}
+
+	if server.PolicyProvider == nil || !coversScopes(server.PolicyProvider.Policy().Permissions(user.Roles), req.GetScopes()) {
+		return nil, status.Errorf(codes.PermissionDenied, "scopes exceed the permissions of user %s", user.UserName)
+	}
+
+	//the interceptor keeps scoped tokens away from this RPC, checked again so the handler does not rely on it
+	if claims.Scoped() && !coversScopes(claims.Scopes, req.GetScopes()) {
+		return nil, status.Errorf(codes.PermissionDenied, "scopes exceed the scopes of the access token")
+	}
+
+	token, expiresAt, err := server.jwtmanager.GenerateDelegated(user, req.GetScopes(), duration)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot generate access token: %v", err)
+	}
+
+	interceptors.SetEvent(ctx, fmt.Sprintf("user %s created a delegated token with scopes %v until %v", user.UserName, req.GetScopes(), expiresAt))
+	res := &pb.CreateDelegatedTokenResponse{
 		AccessToken: token,
+		ExpiresAt:   timestamppb.New(expiresAt),
+	}
+
+	return res, nil
+}
+
+//EnrollTOTP generates a new TOTP secret for the caller, codes are required at login once the
+//enrolment is confirmed, users who already confirmed an enrolment cannot replace the secret
+func (server *AuthServer) EnrollTOTP(ctx context.Context, req *pb.EnrollTOTPRequest) (*pb.EnrollTOTPResponse, error) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "two-factor authentication can only be enrolled with an access token")
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+
+	user, err := server.UserStore.Modify(claims.Username, func(user *store.User) error {
+		if user.TOTPEnabled {
+			return errTOTPEnabled
+		}
+
+		user.TOTPSecret = secret
+		user.TOTPCounter = 0
+		return nil
+	})
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return nil, status.Errorf(codes.Unauthenticated, "user %s no longer exists", claims.Username)
+	case errors.Is(err, errTOTPEnabled):
+		return nil, status.Errorf(codes.FailedPrecondition, "user %s is already enrolled in two-factor authentication", claims.Username)
+	case err != nil:
+		return nil, storeError(err, "cannot update user")
+	}
+
+	interceptors.SetEvent(ctx, fmt.Sprintf("user %s started the two-factor enrolment", user.UserName))
+	res := &pb.EnrollTOTPResponse{
+		Secret: secret,
+		Uri:    totpURI(server.TOTPIssuer, user.UserName, secret),
 	}
 
 	return res, nil
 }
+
+//ConfirmTOTP completes the enrolment of the caller with a code generated from the new secret and
+//the current password of the caller, wrong passwords are throttled like failed logins
+func (server *AuthServer) ConfirmTOTP(ctx context.Context, req *pb.ConfirmTOTPRequest) (*pb.ConfirmTOTPResponse, error) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "two-factor authentication can only be enrolled with an access token")
+	}
+
+	limiterKeys := []string{userLimiterKey(claims.Username), peerLimiterKey(ctx)}
+	release, wait := server.LoginLimiter.Begin(limiterKeys...)
+	defer release()
+	if wait > 0 {
+		return nil, retryError(wait)
+	}
+
+	user, err := server.UserStore.Find(claims.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find user: %v", err)
+	}
+
+	if user == nil {
+		return nil, status.Errorf(codes.Unauthenticated, "user %s no longer exists", claims.Username)
+	}
+
+	if !user.IsCorrectPassword(req.GetPassword()) {
+		server.LoginLimiter.Fail(limiterKeys...)
+		return nil, status.Errorf(codes.PermissionDenied, "incorrect password")
+	}
+
+	server.LoginLimiter.Unlock(userLimiterKey(user.UserName))
+	ok, err = server.useOneTimeCode(claims.Username, req.GetOneTimeCode(), true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "incorrect one-time code")
+	}
+
+	interceptors.SetEvent(ctx, fmt.Sprintf("user %s enrolled in two-factor authentication", claims.Username))
+	return &pb.ConfirmTOTPResponse{}, nil
+}
+
+//rehashPassword hashes the password again with the current hasher when the stored hash uses
+//outdated parameters, failures only go to the request log since the password was already verified
+func (server *AuthServer) rehashPassword(ctx context.Context, user *store.User, password string) {
+	if !server.PasswordHasher.NeedsRehash(user.HashedPassword) {
+		return
+	}
+
+	hashedPassword, err := server.PasswordHasher.Hash(password)
+	if err == nil {
+		//the hash is only replaced when it did not change since the login started
+		_, err = server.UserStore.Modify(user.UserName, func(current *store.User) error {
+			if current.HashedPassword != user.HashedPassword {
+				return errPasswordChanged
+			}
+
+			current.HashedPassword = hashedPassword
+			return nil
+		})
+	}
+
+	if errors.Is(err, errPasswordChanged) || errors.Is(err, store.ErrNotFound) {
+		return
+	}
+
+	if err != nil {
+		interceptors.SetEvent(ctx, fmt.Sprintf("cannot rehash the password of user %s: %v", user.UserName, err))
+		return
+	}
+
+	interceptors.SetEvent(ctx, fmt.Sprintf("rehashed the password of user %s", user.UserName))
+}
+
+//useOneTimeCode accepts each TOTP code of the user only once, enable completes the enrolment of the user,
+//it returns false when the code is wrong or was already used
+func (server *AuthServer) useOneTimeCode(userName string, code string, enable bool) (bool, error) {
+	_, err := server.UserStore.Modify(userName, func(user *store.User) error {
+		if user.TOTPSecret == "" {
+			return errTOTPNotEnrolled
+		}
+
+		counter, err := validateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPCounter)
+		if err != nil {
+			return err
+		}
+
+		user.TOTPCounter = counter
+		if enable {
+			user.TOTPEnabled = true
+		}
+
+		return nil
+	})
+	switch {
+	case errors.Is(err, errInvalidOneTimeCode):
+		return false, nil
+	case errors.Is(err, store.ErrNotFound) || errors.Is(err, errTOTPNotEnrolled):
+		return false, status.Errorf(codes.FailedPrecondition, "user %s has not started the two-factor enrolment", userName)
+	case err != nil:
+		return false, status.Errorf(codes.Internal, "cannot validate one-time code: %v", err)
+	}
+
+	return true, nil
+}
+
+func (server *AuthServer) revokeAccessToken(claims *UserClaims) error {
+	err := server.RevocationStore.Revoke(claims.Id, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		return status.Errorf(codes.Internal, "cannot revoke access token: %v", err)
+	}
+
+	return nil
+}
+
+//revokeRefreshToken revokes the family of the refresh token, when userName is set the token must belong to that user
+func (server *AuthServer) revokeRefreshToken(token string, userName string) error {
+	refreshToken, err := server.RefreshTokenStore.Find(hashToken(token))
+	if err != nil {
+		return status.Errorf(codes.Internal, "cannot find refresh token: %v", err)
+	}
+
+	if refreshToken == nil || (userName != "" && refreshToken.UserName != userName) {
+		return status.Errorf(codes.InvalidArgument, "refresh token is invalid")
+	}
+
+	err = server.RefreshTokenStore.RevokeFamily(refreshToken.Family)
+	if err != nil {
+		return status.Errorf(codes.Internal, "cannot revoke refresh tokens: %v", err)
+	}
+
+	return nil
+}
+
+func (server *AuthServer) generateRefreshToken(user *store.User, family string, certThumbprint string) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = server.RefreshTokenStore.Save(&store.RefreshToken{
+		ID:             hashToken(token),
+		Family:         family,
+		UserName:       user.UserName,
+		CertThumbprint: certThumbprint,
+		ExpiresAt:      time.Now().Add(server.refreshTokenDuration),
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot save refresh token: %w", err)
+	}
+
+	return token, nil
+}
+
+//randomToken returns 32 random bytes encoded with base64url
+func randomToken() (string, error) {
+	data := make([]byte, 32)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", fmt.Errorf("cannot read random bytes: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+//hashToken returns the hash under which a random token is stored
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/niroopreddym/interceptors-grpc-go/pb"
+	"github.com/niroopreddym/interceptors-grpc-go/store"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func newTestAuthServer(t *testing.T) *AuthServer {
+	userStore := store.NewInMemoryUserStore()
+	passwordHasher := store.NewBcryptHasher(bcrypt.DefaultCost)
+	user, err := store.NewUser(passwordHasher, "user1", "secret", "user")
+	require.NoError(t, err)
+	require.NoError(t, userStore.Save(user))
+
+	jwtManager := NewJWTManager("secret", time.Minute)
+	return NewAuthServer(userStore, jwtManager, passwordHasher, store.NewInMemoryRefreshTokenStore(), store.NewInMemoryRevocationStore(), NewLoginLimiter(3, time.Millisecond, time.Hour), time.Hour)
+}
+
+func TestServerRefreshTokenRotation(t *testing.T) {
+	t.Parallel()
+
+	server := newTestAuthServer(t)
+	ctx := context.Background()
+
+	login, err := server.Login(ctx, &pb.LoginRequest{Username: "user1", Password: "secret"})
+	require.NoError(t, err)
+	require.NotEmpty(t, login.GetRefreshToken())
+
+	refreshed, err := server.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: login.GetRefreshToken()})
+	require.NoError(t, err)
+	require.NotEmpty(t, refreshed.GetAccessToken())
+	require.NotEqual(t, login.GetRefreshToken(), refreshed.GetRefreshToken())
+
+	claims, err := server.jwtmanager.Verify(refreshed.GetAccessToken())
+	require.NoError(t, err)
+	require.Equal(t, "user1", claims.Username)
+
+	//presenting the rotated token again revokes the whole family
+	_, err = server.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: login.GetRefreshToken()})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = server.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: refreshed.GetRefreshToken()})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestServerCertificateBoundTokens(t *testing.T) {
+	t.Parallel()
+
+	server := newTestAuthServer(t)
+	server.BindTokens = true
+	interceptor, err := NewAuthInterceptor(server.jwtmanager, server.RevocationStore, nil, &AccessPolicy{
+		Rules: []AccessRule{{Method: "/pb.LaptopService/CreateLaptop"}},
+	})
+	require.NoError(t, err)
+
+	cert := &x509.Certificate{Raw: []byte("client certificate")}
+	otherCert := &x509.Certificate{Raw: []byte("other certificate")}
+	certCtx := contextWithCertificate(context.Background(), cert)
+	otherCertCtx := contextWithCertificate(context.Background(), otherCert)
+
+	login, err := server.Login(certCtx, &pb.LoginRequest{Username: "user1", Password: "secret"})
+	require.NoError(t, err)
+
+	claims, err := server.jwtmanager.Verify(login.GetAccessToken())
+	require.NoError(t, err)
+	require.Equal(t, CertThumbprint(cert), claims.Confirmation.CertThumbprint)
+
+	authorize := func(ctx context.Context, token string) error {
+		_, err := interceptor.authorize(metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", token)), "/pb.LaptopService/CreateLaptop")
+		return err
+	}
+
+	require.NoError(t, authorize(certCtx, login.GetAccessToken()))
+	require.Equal(t, codes.Unauthenticated, status.Code(authorize(otherCertCtx, login.GetAccessToken())))
+	require.Equal(t, codes.Unauthenticated, status.Code(authorize(context.Background(), login.GetAccessToken())))
+
+	//a stolen refresh token is neither exchanged nor burnt
+	_, err = server.RefreshToken(otherCertCtx, &pb.RefreshTokenRequest{RefreshToken: login.GetRefreshToken()})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	refreshed, err := server.RefreshToken(certCtx, &pb.RefreshTokenRequest{RefreshToken: login.GetRefreshToken()})
+	require.NoError(t, err)
+	require.NoError(t, authorize(certCtx, refreshed.GetAccessToken()))
+	require.Equal(t, codes.Unauthenticated, status.Code(authorize(otherCertCtx, refreshed.GetAccessToken())))
+
+	//tokens of clients without a certificate stay unbound
+	login, err = server.Login(context.Background(), &pb.LoginRequest{Username: "user1", Password: "secret"})
+	require.NoError(t, err)
+	require.NoError(t, authorize(otherCertCtx, login.GetAccessToken()))
+}
+
+func TestServerCreateDelegatedToken(t *testing.T) {
+	t.Parallel()
+
+	server := newTestAuthServer(t)
+	interceptor, err := NewAuthInterceptor(server.jwtmanager, server.RevocationStore, nil, &AccessPolicy{
+		RolePermissions: map[string][]string{"user": {"laptop:read", "rating:write"}},
+		Rules: []AccessRule{
+			{Method: "/pb.LaptopService/SearchLaptop", Permissions: []string{"laptop:read"}},
+			{Method: "/pb.LaptopService/RateLaptop", Permissions: []string{"rating:write"}},
+			{Method: "/pb.LaptopService/CreateLaptop", Roles: []string{"user"}},
+			{Method: "/pb.AuthService/CreateDelegatedToken"},
+		},
+	})
+	require.NoError(t, err)
+	server.PolicyProvider = interceptor
+
+	login, err := server.Login(context.Background(), &pb.LoginRequest{Username: "user1", Password: "secret"})
+	require.NoError(t, err)
+	claims, err := server.jwtmanager.Verify(login.GetAccessToken())
+	require.NoError(t, err)
+	ctx := contextWithIdentity(context.Background(), &Identity{Principal: claims.Username, Roles: claims.Roles, Claims: claims})
+
+	_, err = server.CreateDelegatedToken(ctx, &pb.CreateDelegatedTokenRequest{Scopes: []string{"laptop:write"}})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = server.CreateDelegatedToken(ctx, &pb.CreateDelegatedTokenRequest{Scopes: []string{"laptop:read"}, Ttl: durationpb.New(time.Hour)})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	delegated, err := server.CreateDelegatedToken(ctx, &pb.CreateDelegatedTokenRequest{Scopes: []string{"laptop:read"}, Ttl: durationpb.New(30 * time.Second)})
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(30*time.Second), delegated.GetExpiresAt().AsTime(), 2*time.Second)
+
+	authorize := func(token string, method string) error {
+		_, err := interceptor.authorize(metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", token)), method)
+		return err
+	}
+
+	require.NoError(t, authorize(delegated.GetAccessToken(), "/pb.LaptopService/SearchLaptop"))
+	require.Equal(t, codes.PermissionDenied, status.Code(authorize(delegated.GetAccessToken(), "/pb.LaptopService/RateLaptop")))
+	require.Equal(t, codes.PermissionDenied, status.Code(authorize(delegated.GetAccessToken(), "/pb.LaptopService/CreateLaptop")))
+	require.Equal(t, codes.PermissionDenied, status.Code(authorize(delegated.GetAccessToken(), "/pb.AuthService/CreateDelegatedToken")))
+
+	//the full token keeps every permission of the role
+	require.NoError(t, authorize(login.GetAccessToken(), "/pb.LaptopService/RateLaptop"))
+	require.NoError(t, authorize(login.GetAccessToken(), "/pb.LaptopService/CreateLaptop"))
+}
+
+func TestServerRefreshTokenInvalid(t *testing.T) {
+	t.Parallel()
+
+	server := newTestAuthServer(t)
+	_, err := server.RefreshToken(context.Background(), &pb.RefreshTokenRequest{RefreshToken: "invalid"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestServerLogout(t *testing.T) {
+	t.Parallel()
+
+	server := newTestAuthServer(t)
+	login, err := server.Login(context.Background(), &pb.LoginRequest{Username: "user1", Password: "secret"})
+	require.NoError(t, err)
+
+	interceptor, err := NewAuthInterceptor(server.jwtmanager, server.RevocationStore, nil, &AccessPolicy{
+		Rules: []AccessRule{
+			{Method: "/pb.AuthService/Logout"},
+			{Method: "/pb.LaptopService/CreateLaptop", Roles: []string{"user"}},
+		},
+	})
+	require.NoError(t, err)
+
+	//the handler needs the claims the interceptor puts into the context
+	_, err = server.Logout(context.Background(), &pb.LogoutRequest{RefreshToken: login.GetRefreshToken()})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", login.GetAccessToken()))
+	_, err = interceptor.Unary()(ctx, &pb.LogoutRequest{RefreshToken: login.GetRefreshToken()}, &grpc.UnaryServerInfo{FullMethod: "/pb.AuthService/Logout"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return server.Logout(ctx, req.(*pb.LogoutRequest))
+	})
+	require.NoError(t, err)
+
+	_, err = interceptor.authorize(ctx, "/pb.LaptopService/CreateLaptop")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = server.RefreshToken(context.Background(), &pb.RefreshTokenRequest{RefreshToken: login.GetRefreshToken()})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestServerTOTPEnrolment(t *testing.T) {
+	t.Parallel()
+
+	server := newTestAuthServer(t)
+	server.LoginLimiter = NewLoginLimiter(10, 0, time.Hour)
+	login := func(code string) error {
+		_, err := server.Login(context.Background(), &pb.LoginRequest{Username: "user1", Password: "secret", OneTimeCode: code})
+		return err
+	}
+
+	claims := &UserClaims{Username: "user1", Roles: []string{"user"}}
+	ctx := contextWithIdentity(context.Background(), &Identity{Principal: claims.Username, Roles: claims.Roles, Claims: claims})
+
+	enrolment, err := server.EnrollTOTP(ctx, &pb.EnrollTOTPRequest{})
+	require.NoError(t, err)
+	require.Contains(t, enrolment.GetUri(), "otpauth://totp/laptop-store:user1?")
+	require.Contains(t, enrolment.GetUri(), "secret="+enrolment.GetSecret())
+
+	//codes are only required once the enrolment is confirmed
+	require.NoError(t, login(""))
+
+	key, err := totpEncoding.DecodeString(enrolment.GetSecret())
+	require.NoError(t, err)
+	counter := totpCounter(time.Now())
+
+	//the current password is required so a stolen access token cannot enable the codes
+	_, err = server.ConfirmTOTP(ctx, &pb.ConfirmTOTPRequest{OneTimeCode: hotp(key, counter, totpDigits)})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = server.ConfirmTOTP(ctx, &pb.ConfirmTOTPRequest{OneTimeCode: hotp(key, counter, totpDigits), Password: "wrong"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = server.ConfirmTOTP(ctx, &pb.ConfirmTOTPRequest{OneTimeCode: "000000x", Password: "secret"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = server.ConfirmTOTP(ctx, &pb.ConfirmTOTPRequest{OneTimeCode: hotp(key, counter, totpDigits), Password: "secret"})
+	require.NoError(t, err)
+
+	_, err = server.EnrollTOTP(ctx, &pb.EnrollTOTPRequest{})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	require.Equal(t, codes.Unauthenticated, status.Code(login("")))
+
+	//the code used to confirm the enrolment cannot be replayed
+	require.Equal(t, codes.Unauthenticated, status.Code(login(hotp(key, counter, totpDigits))))
+
+	next := hotp(key, counter+1, totpDigits)
+	require.NoError(t, login(next))
+	require.Equal(t, codes.Unauthenticated, status.Code(login(next)))
+
+	_, err = server.EnrollTOTP(context.Background(), &pb.EnrollTOTPRequest{})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	//an admin password reset removes the enrolment
+	userServer := NewUserServer(server.UserStore, server.PasswordHasher, server.RefreshTokenStore, server.RevocationStore, server.LoginLimiter, time.Minute)
+	_, err = userServer.ResetPassword(context.Background(), &pb.ResetPasswordRequest{Username: "user1", NewPassword: "secret"})
+	require.NoError(t, err)
+	require.NoError(t, login(""))
+
+	_, err = server.EnrollTOTP(ctx, &pb.EnrollTOTPRequest{})
+	require.NoError(t, err)
+}
+
+func TestServerLoginRehashesPassword(t *testing.T) {
+	t.Parallel()
+
+	server := newTestAuthServer(t)
+	server.PasswordHasher = store.NewArgon2idHasher(1, 64, 1)
+	server.LoginLimiter = NewLoginLimiter(10, 0, time.Hour)
+
+	_, err := server.Login(context.Background(), &pb.LoginRequest{Username: "user1", Password: "wrong"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	user, err := server.UserStore.Find("user1")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(user.HashedPassword, "$2a$"))
+
+	_, err = server.Login(context.Background(), &pb.LoginRequest{Username: "user1", Password: "secret"})
+	require.NoError(t, err)
+
+	user, err = server.UserStore.Find("user1")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(user.HashedPassword, "$argon2id$v=19$m=64,t=1,p=1$"))
+	require.False(t, server.PasswordHasher.NeedsRehash(user.HashedPassword))
+
+	_, err = server.Login(context.Background(), &pb.LoginRequest{Username: "user1", Password: "secret"})
+	require.NoError(t, err)
+}
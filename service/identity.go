@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"path"
+
+	"github.com/niroopreddym/interceptors-grpc-go/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+//Identity is the authenticated caller of a RPC, Claims is set when the caller presented an
+//access token, APIKey when the caller presented an API key and Certificate when the caller
+//presented a client certificate mapped by the policy, Impersonator is set when an admin
+//runs the RPC as the user and holds the identity of the admin, Tenant is the tenant whose
+//laptops the caller sees
+type Identity struct {
+	Principal    string
+	Roles        []string
+	Tenant       string
+	Claims       *UserClaims
+	APIKey       *store.APIKey
+	Certificate  *x509.Certificate
+	Impersonator *Identity
+}
+
+type identityKey struct{}
+
+//IdentityFromContext returns the identity the auth interceptor resolved for the RPC
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok && identity != nil
+}
+
+//ClaimsFromContext returns the claims of the access token the caller authenticated with, false when
+//the caller authenticated with another credential or an admin runs the RPC as another user
+func ClaimsFromContext(ctx context.Context) (*UserClaims, bool) {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok || identity.Claims == nil {
+		return nil, false
+	}
+
+	return identity.Claims, true
+}
+
+//tenantFromContext returns the tenant of the caller, the default tenant for the methods everyone can access
+func tenantFromContext(ctx context.Context) string {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	return identity.Tenant
+}
+
+//callerName returns the principal of the caller for logging, anonymous for the methods everyone can access,
+//an admin running the RPC as a user is named admin (as user)
+func callerName(ctx context.Context) string {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return "anonymous"
+	}
+
+	if identity.Impersonator != nil {
+		return identity.Impersonator.Principal + " (as " + identity.Principal + ")"
+	}
+
+	return identity.Principal
+}
+
+//RealIdentityFromContext returns the identity of the admin when the RPC runs as another user,
+//otherwise the same identity as IdentityFromContext
+func RealIdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := IdentityFromContext(ctx)
+	if ok && identity.Impersonator != nil {
+		return identity.Impersonator, true
+	}
+
+	return identity, ok
+}
+
+func contextWithIdentity(ctx context.Context, identity *Identity) context.Context {
+	if identity == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+//peerCertificate returns the verified leaf certificate of the peer, nil when the peer did not present one
+func peerCertificate(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	var state tls.ConnectionState
+	switch info := p.AuthInfo.(type) {
+	case credentials.TLSInfo:
+		state = info.State
+	case *credentials.TLSInfo:
+		state = info.State
+	default:
+		return nil
+	}
+
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return state.VerifiedChains[0][0]
+}
+
+//CertThumbprint returns the base64url encoded SHA-256 hash of the DER encoding of the certificate,
+//the x5t#S256 confirmation of RFC 8705
+func CertThumbprint(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+//matchesCertificate checks that the peer presented the certificate with the thumbprint,
+//every peer matches an empty thumbprint
+func matchesCertificate(ctx context.Context, certThumbprint string) bool {
+	if certThumbprint == "" {
+		return true
+	}
+
+	cert := peerCertificate(ctx)
+	return cert != nil && subtle.ConstantTimeCompare([]byte(CertThumbprint(cert)), []byte(certThumbprint)) == 1
+}
+
+//certificateNames returns the subject common name followed by the subject alternative names
+func certificateNames(cert *x509.Certificate) []string {
+	var names []string
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+
+	return names
+}
+
+//certIdentity maps the certificate to an identity with the first matching entry of the policy
+func (policy *AccessPolicy) certIdentity(cert *x509.Certificate) *Identity {
+	names := certificateNames(cert)
+	for _, mapping := range policy.CertIdentities {
+		for _, name := range names {
+			matched, err := path.Match(mapping.Subject, name)
+			if mapping.Subject != name && (err != nil || !matched) {
+				continue
+			}
+
+			principal := mapping.Principal
+			if principal == "" {
+				principal = name
+			}
+
+			return &Identity{
+				Principal:   principal,
+				Roles:       mapping.Roles,
+				Tenant:      mapping.Tenant,
+				Certificate: cert,
+			}
+		}
+	}
+
+	return nil
+}
+
+//serverStream overrides the context of a stream so the handler sees the resolved identity
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *serverStream) Context() context.Context {
+	return stream.ctx
+}
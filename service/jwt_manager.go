@@ -1,58 +1,361 @@
 package service
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
 	"fmt"
+	"io/ioutil"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 	"github.com/niroopreddym/interceptors-grpc-go/store"
 )
 
+//defaultKeyID is the kid of the key created by NewJWTManager
+const defaultKeyID = "default"
+
 //JWTManager maages the generation and decryption of the tokens
 type JWTManager struct {
-	secretKey     string
+	mutex         sync.RWMutex
+	signingKey    *SigningKey
+	keys          map[string]*verificationKey
 	tokenDuration time.Duration
 }
 
-//UserClaims claims on token validation
+//SigningKey is a key used to sign or verify tokens, identified by its kid
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey interface{}
+	PublicKey  interface{}
+}
+
+//verificationKey is a key that is still accepted by Verify until retiresAt
+type verificationKey struct {
+	key       *SigningKey
+	retiresAt time.Time
+}
+
+//UserClaims claims on token validation, IssuedAtNano is the issue time in nanoseconds since
+//the revocations of all the tokens of a user are more precise than the seconds of iat
 type UserClaims struct {
 	jwt.StandardClaims
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	IssuedAtNano int64         `json:"iat_ns,omitempty"`
+	Username     string        `json:"username"`
+	Roles        []string      `json:"roles"`
+	Tenant       string        `json:"tenant,omitempty"`
+	Scopes       []string      `json:"scopes,omitempty"`
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+}
+
+//IssueTime returns the issue time of the token, to the second for tokens without iat_ns
+func (claims *UserClaims) IssueTime() time.Time {
+	if claims.IssuedAtNano != 0 {
+		return time.Unix(0, claims.IssuedAtNano)
+	}
+
+	return time.Unix(claims.IssuedAt, 0)
+}
+
+//Scoped tells whether the token is limited to its scopes
+func (claims *UserClaims) Scoped() bool {
+	return len(claims.Scopes) > 0
 }
 
-//NewJWTManager is the constructor
+//Confirmation binds a token to the client certificate with the SHA-256 thumbprint as in RFC 8705
+type Confirmation struct {
+	CertThumbprint string `json:"x5t#S256"`
+}
+
+//NewJWTManager is the constructor for a manager signing HS256 tokens with a shared secret
 func NewJWTManager(secretKey string, tokenDuration time.Duration) *JWTManager {
-	return &JWTManager{
-		secretKey:     secretKey,
+	manager, _ := NewJWTManagerWithKey(NewHMACSigningKey(defaultKeyID, []byte(secretKey)), tokenDuration)
+	return manager
+}
+
+//NewJWTManagerWithKey is the constructor for a manager signing tokens with the given key
+func NewJWTManagerWithKey(signingKey *SigningKey, tokenDuration time.Duration) (*JWTManager, error) {
+	manager := &JWTManager{
+		keys:          make(map[string]*verificationKey),
 		tokenDuration: tokenDuration,
 	}
+
+	err := manager.AddSigningKey(signingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return manager, nil
+}
+
+//NewHMACSigningKey creates a HS256 key from a shared secret
+func NewHMACSigningKey(id string, secret []byte) *SigningKey {
+	return &SigningKey{
+		ID:         id,
+		Method:     jwt.SigningMethodHS256,
+		PrivateKey: secret,
+		PublicKey:  secret,
+	}
+}
+
+//LoadSigningKey loads a RSA or EC private key from a PEM file, RSA keys sign with RS256
+//and EC keys with the ES algorithm matching their curve
+func LoadSigningKey(id string, privateKeyFile string) (*SigningKey, error) {
+	data, err := ioutil.ReadFile(privateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read private key file: %w", err)
+	}
+
+	if rsaKey, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		return &SigningKey{
+			ID:         id,
+			Method:     jwt.SigningMethodRS256,
+			PrivateKey: rsaKey,
+			PublicKey:  &rsaKey.PublicKey,
+		}, nil
+	}
+
+	ecKey, err := jwt.ParseECPrivateKeyFromPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("private key is neither RSA nor EC: %w", err)
+	}
+
+	method, err := ecdsaSigningMethod(ecKey.Curve)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		ID:         id,
+		Method:     method,
+		PrivateKey: ecKey,
+		PublicKey:  &ecKey.PublicKey,
+	}, nil
+}
+
+//LoadVerificationKey loads a RSA or EC public key from a PEM file, the returned key can
+//only be used to verify tokens
+func LoadVerificationKey(id string, publicKeyFile string) (*SigningKey, error) {
+	data, err := ioutil.ReadFile(publicKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read public key file: %w", err)
+	}
+
+	if rsaKey, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return &SigningKey{
+			ID:        id,
+			Method:    jwt.SigningMethodRS256,
+			PublicKey: rsaKey,
+		}, nil
+	}
+
+	ecKey, err := jwt.ParseECPublicKeyFromPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("public key is neither RSA nor EC: %w", err)
+	}
+
+	method, err := ecdsaSigningMethod(ecKey.Curve)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		ID:        id,
+		Method:    method,
+		PublicKey: ecKey,
+	}, nil
+}
+
+func ecdsaSigningMethod(curve elliptic.Curve) (jwt.SigningMethod, error) {
+	switch curve {
+	case elliptic.P256():
+		return jwt.SigningMethodES256, nil
+	case elliptic.P384():
+		return jwt.SigningMethodES384, nil
+	case elliptic.P521():
+		return jwt.SigningMethodES512, nil
+	default:
+		return nil, fmt.Errorf("unsupported EC curve: %s", curve.Params().Name)
+	}
+}
+
+func (key *SigningKey) validate(signing bool) error {
+	if key == nil || key.ID == "" {
+		return fmt.Errorf("key must have an id")
+	}
+
+	if key.Method == nil {
+		return fmt.Errorf("key %s has no signing method", key.ID)
+	}
+
+	var ok bool
+	switch key.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		_, ok = key.PublicKey.([]byte)
+	case *jwt.SigningMethodRSA:
+		_, ok = key.PublicKey.(*rsa.PublicKey)
+		if ok && signing {
+			_, ok = key.PrivateKey.(*rsa.PrivateKey)
+		}
+	case *jwt.SigningMethodECDSA:
+		_, ok = key.PublicKey.(*ecdsa.PublicKey)
+		if ok && signing {
+			_, ok = key.PrivateKey.(*ecdsa.PrivateKey)
+		}
+	default:
+		return fmt.Errorf("key %s uses unsupported signing method %s", key.ID, key.Method.Alg())
+	}
+
+	if !ok {
+		return fmt.Errorf("key %s does not match signing method %s", key.ID, key.Method.Alg())
+	}
+
+	return nil
+}
+
+//AddSigningKey makes key the one used by Generate, the previous signing key keeps
+//verifying until the tokens it signed have expired
+func (manager *JWTManager) AddSigningKey(key *SigningKey) error {
+	err := key.validate(true)
+	if err != nil {
+		return err
+	}
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	if manager.signingKey != nil {
+		previous := manager.keys[manager.signingKey.ID]
+		previous.retiresAt = time.Now().Add(manager.tokenDuration)
+	}
+
+	manager.signingKey = key
+	manager.keys[key.ID] = &verificationKey{key: key}
+	return nil
+}
+
+//AddVerificationKey accepts tokens signed with key without using it for signing
+func (manager *JWTManager) AddVerificationKey(key *SigningKey) error {
+	err := key.validate(false)
+	if err != nil {
+		return err
+	}
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	if manager.signingKey != nil && manager.signingKey.ID == key.ID {
+		return fmt.Errorf("key %s is the current signing key", key.ID)
+	}
+
+	manager.keys[key.ID] = &verificationKey{key: key}
+	return nil
+}
+
+func (manager *JWTManager) verificationKey(id string) *SigningKey {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	now := time.Now()
+	for kid, key := range manager.keys {
+		if !key.retiresAt.IsZero() && now.After(key.retiresAt) {
+			delete(manager.keys, kid)
+		}
+	}
+
+	key := manager.keys[id]
+	if key == nil {
+		return nil
+	}
+
+	return key.key
 }
 
 //Generate generates the token
 func (manager *JWTManager) Generate(user *store.User) (string, error) {
-	claims := UserClaims{
+	return manager.GenerateBound(user, "")
+}
+
+//GenerateBound generates a token bound to the client certificate with the thumbprint,
+//the token is not bound when the thumbprint is empty
+func (manager *JWTManager) GenerateBound(user *store.User, certThumbprint string) (string, error) {
+	claims := manager.newClaims(user, manager.tokenDuration)
+	if certThumbprint != "" {
+		claims.Confirmation = &Confirmation{CertThumbprint: certThumbprint}
+	}
+
+	return manager.sign(claims)
+}
+
+//GenerateDelegated generates a token limited to the scopes that expires after the duration,
+//which is capped at the duration of regular tokens
+func (manager *JWTManager) GenerateDelegated(user *store.User, scopes []string, duration time.Duration) (string, time.Time, error) {
+	if len(scopes) == 0 {
+		return "", time.Time{}, fmt.Errorf("delegated token needs at least one scope")
+	}
+
+	if duration <= 0 || duration > manager.tokenDuration {
+		duration = manager.tokenDuration
+	}
+
+	claims := manager.newClaims(user, duration)
+	claims.Scopes = scopes
+
+	token, err := manager.sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, time.Unix(claims.ExpiresAt, 0), nil
+}
+
+func (manager *JWTManager) newClaims(user *store.User, duration time.Duration) *UserClaims {
+	now := time.Now()
+	return &UserClaims{
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(manager.tokenDuration).Unix(),
+			Id:        uuid.New().String(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(duration).Unix(),
 		},
-		Username: user.UserName,
-		Role:     user.Role,
+		IssuedAtNano: now.UnixNano(),
+		Username:     user.UserName,
+		Roles:        user.Roles,
+		Tenant:       user.Tenant,
 	}
+}
+
+func (manager *JWTManager) sign(claims *UserClaims) (string, error) {
+	manager.mutex.RLock()
+	key := manager.signingKey
+	manager.mutex.RUnlock()
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(manager.secretKey))
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
 }
 
-//Verify validates the given token
+//Verify validates the given token against the key named by its kid header
 func (manager *JWTManager) Verify(accessToken string) (*UserClaims, error) {
 	token, err := jwt.ParseWithClaims(
 		accessToken, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
-			_, ok := token.Method.(*jwt.SigningMethodHMAC)
+			kid, ok := token.Header["kid"].(string)
 			if !ok {
-				return nil, fmt.Errorf("unexpected token siging method")
+				return nil, fmt.Errorf("token has no key id")
+			}
+
+			key := manager.verificationKey(kid)
+			if key == nil {
+				return nil, fmt.Errorf("unknown signing key: %s", kid)
+			}
+
+			if token.Method.Alg() != key.Method.Alg() {
+				return nil, fmt.Errorf("unexpected token siging method: %s", token.Method.Alg())
 			}
 
-			return []byte(manager.secretKey), nil
+			return key.PublicKey, nil
 		},
 	)
 
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/niroopreddym/interceptors-grpc-go/store"
+	"github.com/stretchr/testify/require"
+)
+
+func writePrivateKeyPEM(t *testing.T, key interface{}) string {
+	var block *pem.Block
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(key)
+		require.NoError(t, err)
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	}
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600))
+	return path
+}
+
+func TestJWTManagerAsymmetricKeys(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		key    interface{}
+		method jwt.SigningMethod
+	}{
+		{name: "rs256", key: rsaKey, method: jwt.SigningMethodRS256},
+		{name: "es256", key: ecKey, method: jwt.SigningMethodES256},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			signingKey, err := LoadSigningKey("kid-"+tc.name, writePrivateKeyPEM(t, tc.key))
+			require.NoError(t, err)
+			require.Equal(t, tc.method, signingKey.Method)
+
+			manager, err := NewJWTManagerWithKey(signingKey, time.Minute)
+			require.NoError(t, err)
+
+			token, err := manager.Generate(&store.User{UserName: "user1", Roles: []string{"user"}})
+			require.NoError(t, err)
+
+			claims, err := manager.Verify(token)
+			require.NoError(t, err)
+			require.Equal(t, "user1", claims.Username)
+
+			verifier, err := NewJWTManagerWithKey(NewHMACSigningKey("other", []byte("secret")), time.Minute)
+			require.NoError(t, err)
+			_, err = verifier.Verify(token)
+			require.Error(t, err)
+
+			require.NoError(t, verifier.AddVerificationKey(&SigningKey{ID: signingKey.ID, Method: signingKey.Method, PublicKey: signingKey.PublicKey}))
+			_, err = verifier.Verify(token)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestJWTManagerKeyRotation(t *testing.T) {
+	t.Parallel()
+
+	manager := NewJWTManager("secret-1", time.Minute)
+	user := &store.User{UserName: "user1", Roles: []string{"user"}}
+
+	oldToken, err := manager.Generate(user)
+	require.NoError(t, err)
+
+	require.NoError(t, manager.AddSigningKey(NewHMACSigningKey("key-2", []byte("secret-2"))))
+
+	newToken, err := manager.Generate(user)
+	require.NoError(t, err)
+
+	parsed, _, err := new(jwt.Parser).ParseUnverified(newToken, &UserClaims{})
+	require.NoError(t, err)
+	require.Equal(t, "key-2", parsed.Header["kid"])
+
+	_, err = manager.Verify(oldToken)
+	require.NoError(t, err)
+	_, err = manager.Verify(newToken)
+	require.NoError(t, err)
+
+	manager.keys[defaultKeyID].retiresAt = time.Now().Add(-time.Second)
+	_, err = manager.Verify(oldToken)
+	require.Error(t, err)
+}
+
+func TestJWTManagerRejectsAlgorithmMismatch(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	manager, err := NewJWTManagerWithKey(&SigningKey{
+		ID:         "rsa",
+		Method:     jwt.SigningMethodRS256,
+		PrivateKey: rsaKey,
+		PublicKey:  &rsaKey.PublicKey,
+	}, time.Minute)
+	require.NoError(t, err)
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, UserClaims{Username: "user1"})
+	token.Header["kid"] = "rsa"
+	forged, err := token.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	require.NoError(t, err)
+
+	_, err = manager.Verify(forged)
+	require.Error(t, err)
+}
+
+func TestJWTManagerTenantClaim(t *testing.T) {
+	t.Parallel()
+
+	manager := NewJWTManager("secret", time.Minute)
+	token, err := manager.Generate(&store.User{UserName: "user1", Roles: []string{"user"}, Tenant: "tenant-a"})
+	require.NoError(t, err)
+
+	claims, err := manager.Verify(token)
+	require.NoError(t, err)
+	require.Equal(t, "tenant-a", claims.Tenant)
+}
@@ -34,7 +34,7 @@ func TestClientCreatelaptop(t *testing.T) {
 	assert.Equal(t, expectedID, res.Id)
 
 	//check the laptop saved to the store
-	other, err := laptopStore.Find(laptop.Id)
+	other, err := laptopStore.Find("", laptop.Id)
 	assert.NoError(t, err)
 	assert.NotNil(t, other)
 
@@ -89,7 +89,7 @@ func TestClientSearchlaptop(t *testing.T) {
 			expectedIDs[laptop.Id] = true
 		}
 
-		err := store.Save(laptop)
+		err := store.Save("", laptop)
 		assert.Nil(t, err)
 	}
 
@@ -125,7 +125,7 @@ func TestClientRateLaptop(t *testing.T) {
 	ratingStore := store.NewInMemoryRatingStore()
 
 	laptop := sample.NewLaptop()
-	err := laptopStore.Save(laptop)
+	err := laptopStore.Save("", laptop)
 	assert.NoError(t, err)
 
 	serverAddress := startTestLaptopServer(t, laptopStore, nil, ratingStore)
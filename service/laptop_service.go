@@ -4,21 +4,28 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
-	"log"
 
 	"github.com/google/uuid"
+	"github.com/niroopreddym/interceptors-grpc-go/interceptors"
 	"github.com/niroopreddym/interceptors-grpc-go/pb"
 	"github.com/niroopreddym/interceptors-grpc-go/store"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-//LaptopServer implements the laptop server proto server interface
+//laptopAdminPermission lets a caller change laptops owned by others
+const laptopAdminPermission = "laptop:admin"
+
+//LaptopServer implements the laptop server proto server interface, callers only see the laptops,
+//images and ratings of their tenant and the callers granted laptop:admin by the policy of
+//PolicyProvider may change laptops of their tenant they do not own
 type LaptopServer struct {
-	Store       store.LaptopStore
-	ImageStore  *store.DiskImageStore
-	RatingStore store.RatingStore
+	Store          store.LaptopStore
+	ImageStore     *store.DiskImageStore
+	RatingStore    store.RatingStore
+	PolicyProvider PolicyProvider
 }
 
 //NewLaptopServer provides the constructor for laptop server
@@ -33,7 +40,6 @@ func NewLaptopServer(store store.LaptopStore, imageStore *store.DiskImageStore,
 //CreateLaptop is the unary rpc implemetation to create a new laptop
 func (server *LaptopServer) CreateLaptop(ctx context.Context, req *pb.CreateLaptopRequest) (*pb.CreateLaptopResponse, error) {
 	laptop := req.GetLaptop()
-	log.Println("recieved a create-laptop request with id: ", laptop.Id)
 
 	if len(laptop.Id) > 0 {
 		_, err := uuid.Parse(laptop.Id)
@@ -49,20 +55,23 @@ func (server *LaptopServer) CreateLaptop(ctx context.Context, req *pb.CreateLapt
 		laptop.Id = id.String()
 	}
 
+	laptop.Owner = ""
+	if identity, ok := IdentityFromContext(ctx); ok {
+		laptop.Owner = identity.Principal
+	}
+
 	//mock some heavy processing before finishing off the service request
 	// time.Sleep(6 * time.Second)
 
 	if ctx.Err() == context.Canceled {
-		log.Println("ctx cancelled")
 		return nil, status.Error(codes.Canceled, "ctx cancelled")
 	}
 
 	if ctx.Err() == context.DeadlineExceeded {
-		log.Println("deadline exceeded")
 		return nil, status.Error(codes.DeadlineExceeded, "deadline exceeded")
 	}
 
-	err := server.Store.Save(laptop)
+	err := server.Store.Save(tenantFromContext(ctx), laptop)
 	if err != nil {
 		code := codes.Internal
 		if errors.Is(err, store.ErrAlreadyExists) {
@@ -72,7 +81,7 @@ func (server *LaptopServer) CreateLaptop(ctx context.Context, req *pb.CreateLapt
 		return nil, status.Error(code, "cannot save laptop to the store: "+err.Error())
 	}
 
-	log.Printf("laptop save diwth id: %s", laptop.Id)
+	interceptors.SetEvent(ctx, fmt.Sprintf("created laptop %s", laptop.Id))
 	res := &pb.CreateLaptopResponse{
 		Id: laptop.Id,
 	}
@@ -83,26 +92,18 @@ func (server *LaptopServer) CreateLaptop(ctx context.Context, req *pb.CreateLapt
 //SearchLaptop searches and returns a single laptop from the datastore
 func (server *LaptopServer) SearchLaptop(req *pb.SearchLaptopRequest, stream pb.LaptopService_SearchLaptopServer) error {
 	filter := req.GetFilter()
-	log.Printf("recieve a search-laptop request with filter: %v", filter)
-	err := server.Store.Search(stream.Context(), filter, func(laptop *pb.Laptop) error {
+	err := server.Store.Search(stream.Context(), tenantFromContext(stream.Context()), filter, func(laptop *pb.Laptop) error {
 		response := &pb.SearchLaptopResponse{
 			Laptop: laptop,
 		}
 
-		err := stream.Send(response)
-		if err != nil {
-			return err
-		}
-
-		log.Printf("sent laptop with id : %s", laptop.GetId())
-		return nil
+		return stream.Send(response)
 	})
 
 	if err != nil {
 		return status.Errorf(codes.Internal, "unexpected error: %v", err)
 	}
 
-	log.Printf("Done Server Side code")
 	return nil
 }
 
@@ -112,38 +113,38 @@ const maxImageSize = 1 << 20
 func (server *LaptopServer) UploadImage(stream pb.LaptopService_UploadImageServer) error {
 	req, err := stream.Recv()
 	if err != nil {
-		return logError(status.Errorf(codes.Unknown, "cannot recieve message Info"))
+		return status.Errorf(codes.Unknown, "cannot recieve message Info")
 	}
 
 	laptopID := req.GetInfo().GetLaptopId()
 	ImageType := req.GetInfo().GetImageType()
-	log.Printf("recived upload image request for laptop %s with image type %s", laptopID, ImageType)
+	tenant := tenantFromContext(stream.Context())
 
-	laptop, err := server.Store.Find(laptopID)
+	laptop, err := server.Store.Find(tenant, laptopID)
 	if err != nil {
-		return logError(status.Errorf(codes.Internal, "cannot find laptop: %v", err))
+		return status.Errorf(codes.Internal, "cannot find laptop: %v", err)
 	}
 
 	if laptop == nil {
-		return logError(status.Errorf(codes.InvalidArgument, "laptop: %s does not exist", laptopID))
+		return status.Errorf(codes.InvalidArgument, "laptop: %s does not exist", laptopID)
+	}
+
+	err = server.checkOwner(stream.Context(), laptop)
+	if err != nil {
+		return err
 	}
 
 	imageData := bytes.Buffer{}
 	imageSizeBuffered := 0
 
-	log.Print("entering the read chunk loop")
-
 	for {
-		log.Print("waiting to recieve chunk data")
-
 		req, err := stream.Recv()
 		if err == io.EOF {
-			log.Print("no more data")
 			break
 		}
 
 		if err != nil {
-			return logError(status.Errorf(codes.Unknown, "cannot rcieve chunk data laptop: %v", err))
+			return status.Errorf(codes.Unknown, "cannot rcieve chunk data laptop: %v", err)
 		}
 
 		chunk := req.GetChunkData()
@@ -151,24 +152,23 @@ func (server *LaptopServer) UploadImage(stream pb.LaptopService_UploadImageServe
 
 		imageSizeBuffered += size
 
-		log.Printf("receuved chunk data with size: %d", size)
-
 		if imageSizeBuffered > maxImageSize {
-			return logError(status.Errorf(codes.InvalidArgument, "imageSize too large: %d > %d", imageSizeBuffered, maxImageSize))
+			return status.Errorf(codes.InvalidArgument, "imageSize too large: %d > %d", imageSizeBuffered, maxImageSize)
 		}
 
 		_, err = imageData.Write(chunk)
 		if err != nil {
-			return logError(status.Errorf(codes.Internal, "cannot write chunk data: %v", err))
+			return status.Errorf(codes.Internal, "cannot write chunk data: %v", err)
 		}
 	}
 
-	imageID, err := server.ImageStore.Save(laptopID, ImageType, imageData)
+	imageID, err := server.ImageStore.Save(tenant, laptopID, ImageType, imageData)
 
 	if err != nil {
-		return logError(status.Errorf(codes.Internal, "cannot save image to the store: %v", err))
+		return status.Errorf(codes.Internal, "cannot save image to the store: %v", err)
 	}
 
+	interceptors.SetEvent(stream.Context(), fmt.Sprintf("uploaded image %s of laptop %s", imageID, laptopID))
 	res := &pb.UploadImageResponse{
 		Id:   imageID,
 		Size: uint32(imageSizeBuffered),
@@ -176,23 +176,15 @@ func (server *LaptopServer) UploadImage(stream pb.LaptopService_UploadImageServe
 
 	err = stream.SendAndClose(res)
 	if err != nil {
-		return logError(status.Errorf(codes.Unknown, "cannot send response: %v", err))
+		return status.Errorf(codes.Unknown, "cannot send response: %v", err)
 	}
 
-	log.Printf("saved image with id: %s, size: %d", imageID, imageSizeBuffered)
 	return nil
 }
 
-func logError(err error) error {
-	if err != nil {
-		log.Print(err)
-	}
-
-	return err
-}
-
 //RateLaptop gets the stream of ratings
 func (server *LaptopServer) RateLaptop(stream pb.LaptopService_RateLaptopServer) error {
+	tenant := tenantFromContext(stream.Context())
 	for {
 		err := contextError(stream.Context())
 		if err != nil {
@@ -201,31 +193,28 @@ func (server *LaptopServer) RateLaptop(stream pb.LaptopService_RateLaptopServer)
 
 		req, err := stream.Recv()
 		if err == io.EOF {
-			log.Printf("no more data")
 			break
 		}
 
 		if err != nil {
-			return logError(status.Errorf(codes.Unknown, "cannot recueve stream request: %v", err))
+			return status.Errorf(codes.Unknown, "cannot recueve stream request: %v", err)
 		}
 
 		laptopID := req.GetLaptopId()
 		score := req.GetScore()
 
-		log.Printf("recieved a rate-laptop request: id=%s, score=%.2f", laptopID, score)
-
-		found, err := server.Store.Find(laptopID)
+		found, err := server.Store.Find(tenant, laptopID)
 		if err != nil {
-			return logError(status.Errorf(codes.Internal, "cannot find laptopt: %v", err))
+			return status.Errorf(codes.Internal, "cannot find laptopt: %v", err)
 		}
 
 		if found == nil {
-			return logError(status.Errorf(codes.NotFound, "laptop wit ID : %s not found", laptopID))
+			return status.Errorf(codes.NotFound, "laptop wit ID : %s not found", laptopID)
 		}
 
-		rating, err := server.RatingStore.Add(laptopID, score)
+		rating, err := server.RatingStore.Add(tenant, laptopID, score)
 		if err != nil {
-			return logError(status.Errorf(codes.Internal, "cannot add rating to the store: %v", err))
+			return status.Errorf(codes.Internal, "cannot add rating to the store: %v", err)
 		}
 
 		res := &pb.RateLaptopResponse{
@@ -236,19 +225,37 @@ func (server *LaptopServer) RateLaptop(stream pb.LaptopService_RateLaptopServer)
 
 		err = stream.Send(res)
 		if err != nil {
-			return logError(status.Errorf(codes.Unknown, "cannot send stream response: %v", err))
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
 		}
 	}
 
 	return nil
 }
 
+//checkOwner allows the owner of the laptop and the callers granted laptop:admin to change it
+func (server *LaptopServer) checkOwner(ctx context.Context, laptop *pb.Laptop) error {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return status.Errorf(codes.PermissionDenied, "only the owner can change laptop %s", laptop.GetId())
+	}
+
+	if laptop.GetOwner() != "" && laptop.GetOwner() == identity.Principal {
+		return nil
+	}
+
+	if server.PolicyProvider != nil && coversScopes(server.PolicyProvider.Policy().Permissions(identity.Roles), []string{laptopAdminPermission}) {
+		return nil
+	}
+
+	return status.Errorf(codes.PermissionDenied, "only the owner can change laptop %s", laptop.GetId())
+}
+
 func contextError(ctx context.Context) error {
 	switch ctx.Err() {
 	case context.Canceled:
-		return logError(status.Error(codes.Canceled, "request is canceled"))
+		return status.Error(codes.Canceled, "request is canceled")
 	case context.DeadlineExceeded:
-		return logError(status.Error(codes.DeadlineExceeded, "deadline is exceeded"))
+		return status.Error(codes.DeadlineExceeded, "deadline is exceeded")
 	default:
 		return nil
 	}
@@ -2,13 +2,18 @@ package service
 
 import (
 	"context"
+	"io"
 	"testing"
+	"time"
 
 	"github.com/niroopreddym/interceptors-grpc-go/pb"
 	"github.com/niroopreddym/interceptors-grpc-go/sample"
 	"github.com/niroopreddym/interceptors-grpc-go/store"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -23,7 +28,7 @@ func TestServerCreateLaptop(t *testing.T) {
 
 	laptopDuplicateID := sample.NewLaptop()
 	storeDuplicate := store.NewInMemoryLaptopStore()
-	err := storeDuplicate.Save(laptopDuplicateID)
+	err := storeDuplicate.Save("", laptopDuplicateID)
 	assert.Nil(t, err)
 
 	testCases := []struct {
@@ -85,3 +90,244 @@ func TestServerCreateLaptop(t *testing.T) {
 		})
 	}
 }
+
+//uploadImageStream feeds the requests to UploadImage and keeps its response
+type uploadImageStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	requests []*pb.UploadImageRequest
+	response *pb.UploadImageResponse
+}
+
+func (stream *uploadImageStream) Context() context.Context {
+	return stream.ctx
+}
+
+func (stream *uploadImageStream) Recv() (*pb.UploadImageRequest, error) {
+	if len(stream.requests) == 0 {
+		return nil, io.EOF
+	}
+
+	req := stream.requests[0]
+	stream.requests = stream.requests[1:]
+	return req, nil
+}
+
+func (stream *uploadImageStream) SendAndClose(res *pb.UploadImageResponse) error {
+	stream.response = res
+	return nil
+}
+
+func TestServerLaptopOwnership(t *testing.T) {
+	t.Parallel()
+
+	imageStore := store.NewDiskImageStore(t.TempDir())
+	server := NewLaptopServer(store.NewInMemoryLaptopStore(), &imageStore, nil)
+	interceptor, err := NewAuthInterceptor(NewJWTManager("secret", time.Minute), store.NewInMemoryRevocationStore(), nil, &AccessPolicy{
+		RolePermissions: map[string][]string{"admin": {"laptop:*"}},
+	})
+	require.NoError(t, err)
+	server.PolicyProvider = interceptor
+
+	ownerCtx := contextWithIdentity(context.Background(), &Identity{Principal: "user1", Roles: []string{"user"}})
+	otherCtx := contextWithIdentity(context.Background(), &Identity{Principal: "user2", Roles: []string{"user"}})
+	adminCtx := contextWithIdentity(context.Background(), &Identity{Principal: "admin1", Roles: []string{"admin"}})
+
+	laptop := sample.NewLaptop()
+	laptop.Owner = "user2"
+	res, err := server.CreateLaptop(ownerCtx, &pb.CreateLaptopRequest{Laptop: laptop})
+	require.NoError(t, err)
+
+	found, err := server.Store.Find("", res.GetId())
+	require.NoError(t, err)
+	require.Equal(t, "user1", found.GetOwner())
+
+	upload := func(ctx context.Context) error {
+		return server.UploadImage(&uploadImageStream{
+			ctx: ctx,
+			requests: []*pb.UploadImageRequest{
+				{Data: &pb.UploadImageRequest_Info{Info: &pb.ImageInfo{LaptopId: res.GetId(), ImageType: ".jpg"}}},
+				{Data: &pb.UploadImageRequest_ChunkData{ChunkData: []byte("image")}},
+			},
+		})
+	}
+
+	require.NoError(t, upload(ownerCtx))
+	require.NoError(t, upload(adminCtx))
+	require.Equal(t, codes.PermissionDenied, status.Code(upload(otherCtx)))
+	require.Equal(t, codes.PermissionDenied, status.Code(upload(context.Background())))
+}
+
+//searchLaptopStream collects the laptops sent by SearchLaptop
+type searchLaptopStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	laptops []*pb.Laptop
+}
+
+func (stream *searchLaptopStream) Context() context.Context {
+	return stream.ctx
+}
+
+func (stream *searchLaptopStream) Send(res *pb.SearchLaptopResponse) error {
+	stream.laptops = append(stream.laptops, res.GetLaptop())
+	return nil
+}
+
+//rateLaptopStream feeds the requests to RateLaptop and collects its responses
+type rateLaptopStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	requests  []*pb.RateLaptopRequest
+	responses []*pb.RateLaptopResponse
+}
+
+func (stream *rateLaptopStream) Context() context.Context {
+	return stream.ctx
+}
+
+func (stream *rateLaptopStream) Recv() (*pb.RateLaptopRequest, error) {
+	if len(stream.requests) == 0 {
+		return nil, io.EOF
+	}
+
+	req := stream.requests[0]
+	stream.requests = stream.requests[1:]
+	return req, nil
+}
+
+func (stream *rateLaptopStream) Send(res *pb.RateLaptopResponse) error {
+	stream.responses = append(stream.responses, res)
+	return nil
+}
+
+func TestServerTenantIsolation(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := store.NewInMemoryLaptopStore()
+	imageStore := store.NewDiskImageStore(t.TempDir())
+	server := NewLaptopServer(laptopStore, &imageStore, store.NewInMemoryRatingStore())
+
+	ctxA := contextWithIdentity(context.Background(), &Identity{Principal: "user1", Roles: []string{"user"}, Tenant: "tenant-a"})
+	ctxB := contextWithIdentity(context.Background(), &Identity{Principal: "user2", Roles: []string{"user"}, Tenant: "tenant-b"})
+
+	laptopA := sample.NewLaptop()
+	_, err := server.CreateLaptop(ctxA, &pb.CreateLaptopRequest{Laptop: laptopA})
+	require.NoError(t, err)
+
+	laptopB := sample.NewLaptop()
+	_, err = server.CreateLaptop(ctxB, &pb.CreateLaptopRequest{Laptop: laptopB})
+	require.NoError(t, err)
+
+	found, err := laptopStore.Find("tenant-b", laptopA.GetId())
+	require.NoError(t, err)
+	require.Nil(t, found)
+
+	filter := &pb.Filter{MaxPriceUsd: 1e9}
+	for ctx, expectedID := range map[context.Context]string{ctxA: laptopA.GetId(), ctxB: laptopB.GetId()} {
+		stream := &searchLaptopStream{ctx: ctx}
+		require.NoError(t, server.SearchLaptop(&pb.SearchLaptopRequest{Filter: filter}, stream))
+		require.Len(t, stream.laptops, 1)
+		require.Equal(t, expectedID, stream.laptops[0].GetId())
+	}
+
+	anonymous := &searchLaptopStream{ctx: context.Background()}
+	require.NoError(t, server.SearchLaptop(&pb.SearchLaptopRequest{Filter: filter}, anonymous))
+	require.Empty(t, anonymous.laptops)
+
+	uploadB := &uploadImageStream{
+		ctx: ctxB,
+		requests: []*pb.UploadImageRequest{
+			{Data: &pb.UploadImageRequest_Info{Info: &pb.ImageInfo{LaptopId: laptopA.GetId(), ImageType: ".jpg"}}},
+			{Data: &pb.UploadImageRequest_ChunkData{ChunkData: []byte("image")}},
+		},
+	}
+	require.Equal(t, codes.InvalidArgument, status.Code(server.UploadImage(uploadB)))
+
+	uploadA := &uploadImageStream{
+		ctx: ctxA,
+		requests: []*pb.UploadImageRequest{
+			{Data: &pb.UploadImageRequest_Info{Info: &pb.ImageInfo{LaptopId: laptopA.GetId(), ImageType: ".jpg"}}},
+			{Data: &pb.UploadImageRequest_ChunkData{ChunkData: []byte("image")}},
+		},
+	}
+	require.NoError(t, server.UploadImage(uploadA))
+
+	imageID := uploadA.response.GetId()
+	image, err := imageStore.Find("tenant-b", imageID)
+	require.NoError(t, err)
+	require.Nil(t, image)
+
+	image, err = imageStore.Find("tenant-a", imageID)
+	require.NoError(t, err)
+	require.NotNil(t, image)
+
+	rateB := &rateLaptopStream{ctx: ctxB, requests: []*pb.RateLaptopRequest{{LaptopId: laptopA.GetId(), Score: 1}}}
+	require.Equal(t, codes.NotFound, status.Code(server.RateLaptop(rateB)))
+
+	//the same laptop id in two tenants keeps separate rating averages
+	shared := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save("tenant-a", shared))
+	require.NoError(t, laptopStore.Save("tenant-b", shared))
+
+	rateA := &rateLaptopStream{ctx: ctxA, requests: []*pb.RateLaptopRequest{{LaptopId: shared.GetId(), Score: 10}, {LaptopId: shared.GetId(), Score: 8}}}
+	require.NoError(t, server.RateLaptop(rateA))
+	require.Len(t, rateA.responses, 2)
+	require.Equal(t, uint32(2), rateA.responses[1].GetRatedCount())
+	require.Equal(t, 9.0, rateA.responses[1].GetAverageScore())
+
+	rateB = &rateLaptopStream{ctx: ctxB, requests: []*pb.RateLaptopRequest{{LaptopId: shared.GetId(), Score: 2}}}
+	require.NoError(t, server.RateLaptop(rateB))
+	require.Len(t, rateB.responses, 1)
+	require.Equal(t, uint32(1), rateB.responses[0].GetRatedCount())
+	require.Equal(t, 2.0, rateB.responses[0].GetAverageScore())
+}
+
+func TestServerTenantSearchThroughInterceptor(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := store.NewInMemoryLaptopStore()
+	imageStore := store.NewDiskImageStore(t.TempDir())
+	server := NewLaptopServer(laptopStore, &imageStore, store.NewInMemoryRatingStore())
+
+	//the built-in rules of the proto options, where SearchLaptop is public
+	jwtManager := NewJWTManager("secret", time.Minute)
+	interceptor, err := NewAuthInterceptor(jwtManager, store.NewInMemoryRevocationStore(), nil, &AccessPolicy{DefaultDeny: true, ProtoRules: true})
+	require.NoError(t, err)
+
+	laptopA := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save("tenant-a", laptopA))
+	laptopDefault := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save("", laptopDefault))
+
+	token, err := jwtManager.Generate(&store.User{UserName: "user1", Roles: []string{"user"}, Tenant: "tenant-a"})
+	require.NoError(t, err)
+
+	search := func(ctx context.Context) ([]string, error) {
+		var ids []string
+		info := &grpc.StreamServerInfo{FullMethod: "/pb.LaptopService/SearchLaptop", IsServerStream: true}
+		err := interceptor.Stream()(nil, &searchLaptopStream{ctx: ctx}, info, func(srv interface{}, ss grpc.ServerStream) error {
+			stream := &searchLaptopStream{ctx: ss.Context()}
+			err := server.SearchLaptop(&pb.SearchLaptopRequest{Filter: &pb.Filter{MaxPriceUsd: 1e9}}, stream)
+			for _, laptop := range stream.laptops {
+				ids = append(ids, laptop.GetId())
+			}
+
+			return err
+		})
+
+		return ids, err
+	}
+
+	ids, err := search(metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", token)))
+	require.NoError(t, err)
+	require.Equal(t, []string{laptopA.GetId()}, ids)
+
+	ids, err = search(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{laptopDefault.GetId()}, ids)
+
+	//an invalid token is rejected rather than falling back to the default tenant
+	_, err = search(metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "invalid")))
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
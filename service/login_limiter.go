@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+//inFlightRetryDelay is the wait suggested to callers rejected because the attempts in flight could
+//reach the lockout, they resolve within the time of a password check
+const inFlightRetryDelay = 100 * time.Millisecond
+
+//LoginLimiter throttles failed logins per username and per peer address, every failure doubles the
+//wait before the next attempt and maxFailures failures in a row lock the key for lockDuration,
+//the attempts in flight count towards maxFailures so parallel guesses cannot pass the lockout
+type LoginLimiter struct {
+	mutex        sync.Mutex
+	maxFailures  int
+	baseDelay    time.Duration
+	lockDuration time.Duration
+	attempts     map[string]*loginAttempts
+}
+
+type loginAttempts struct {
+	inFlight     int
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+//NewLoginLimiter is the constructor for the login limiter
+func NewLoginLimiter(maxFailures int, baseDelay time.Duration, lockDuration time.Duration) *LoginLimiter {
+	return &LoginLimiter{
+		maxFailures:  maxFailures,
+		baseDelay:    baseDelay,
+		lockDuration: lockDuration,
+		attempts:     make(map[string]*loginAttempts),
+	}
+}
+
+//Check returns how long the caller must wait before trying the keys again, zero when an attempt is allowed
+func (limiter *LoginLimiter) Check(keys ...string) time.Duration {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range keys {
+		attempts := limiter.attempts[key]
+		if attempts != nil && attempts.blockedUntil.Sub(now) > wait {
+			wait = attempts.blockedUntil.Sub(now)
+		}
+	}
+
+	return wait
+}
+
+//Begin starts an attempt for the keys unless the caller must wait, in which case it returns the wait,
+//the attempt counts as a failure for the lockout until release is called, which must happen once
+//the attempt was recorded with Fail or Unlock
+func (limiter *LoginLimiter) Begin(keys ...string) (release func(), wait time.Duration) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		attempts := limiter.attempts[key]
+		if attempts == nil {
+			continue
+		}
+
+		if attempts.blockedUntil.Sub(now) > wait {
+			wait = attempts.blockedUntil.Sub(now)
+		}
+
+		if attempts.failures+attempts.inFlight >= limiter.maxFailures && wait < inFlightRetryDelay {
+			wait = inFlightRetryDelay
+		}
+	}
+
+	if wait > 0 {
+		return func() {}, wait
+	}
+
+	for _, key := range keys {
+		attempts := limiter.attempts[key]
+		if attempts == nil {
+			attempts = &loginAttempts{}
+			limiter.attempts[key] = attempts
+		}
+
+		attempts.inFlight++
+	}
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			limiter.release(keys)
+		})
+	}
+
+	return release, 0
+}
+
+func (limiter *LoginLimiter) release(keys []string) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	for _, key := range keys {
+		attempts := limiter.attempts[key]
+		if attempts == nil {
+			continue
+		}
+
+		attempts.inFlight--
+		if attempts.inFlight == 0 && attempts.failures == 0 {
+			delete(limiter.attempts, key)
+		}
+	}
+}
+
+//Fail records a failed login for the keys
+func (limiter *LoginLimiter) Fail(keys ...string) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := time.Now()
+	for key, attempts := range limiter.attempts {
+		if attempts.inFlight == 0 && now.Sub(attempts.lastFailure) > limiter.lockDuration && now.After(attempts.blockedUntil) {
+			delete(limiter.attempts, key)
+		}
+	}
+
+	for _, key := range keys {
+		attempts := limiter.attempts[key]
+		if attempts == nil {
+			attempts = &loginAttempts{}
+			limiter.attempts[key] = attempts
+		}
+
+		attempts.failures++
+		attempts.lastFailure = now
+
+		if attempts.failures >= limiter.maxFailures {
+			attempts.blockedUntil = now.Add(limiter.lockDuration)
+			continue
+		}
+
+		attempts.blockedUntil = now.Add(limiter.backoff(attempts.failures))
+	}
+}
+
+//backoff returns baseDelay doubled for every failure after the first, at most lockDuration,
+//the delay is doubled step by step so that it cannot overflow
+func (limiter *LoginLimiter) backoff(failures int) time.Duration {
+	delay := limiter.baseDelay
+	for i := 1; i < failures; i++ {
+		if delay > limiter.lockDuration/2 {
+			return limiter.lockDuration
+		}
+
+		delay *= 2
+	}
+
+	if delay > limiter.lockDuration {
+		return limiter.lockDuration
+	}
+
+	return delay
+}
+
+//Unlock forgets the failures recorded for the key, the attempts in flight still count
+func (limiter *LoginLimiter) Unlock(key string) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	attempts := limiter.attempts[key]
+	if attempts == nil {
+		return
+	}
+
+	if attempts.inFlight > 0 {
+		*attempts = loginAttempts{inFlight: attempts.inFlight}
+		return
+	}
+
+	delete(limiter.attempts, key)
+}
+
+func userLimiterKey(userName string) string {
+	return "user:" + userName
+}
+
+func peerLimiterKey(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "peer:unknown"
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+
+	return "peer:" + host
+}
+
+func retryError(wait time.Duration) error {
+	st := status.Newf(codes.ResourceExhausted, "too many failed login attempts, retry in %v", wait.Round(time.Millisecond))
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(wait),
+	})
+	if err != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
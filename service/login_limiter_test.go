@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/niroopreddym/interceptors-grpc-go/pb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestLoginLimiterBackoff(t *testing.T) {
+	t.Parallel()
+
+	limiter := NewLoginLimiter(4, time.Second, time.Hour)
+	require.Zero(t, limiter.Check("user:user1"))
+
+	limiter.Fail("user:user1")
+	first := limiter.Check("user:user1")
+	limiter.Fail("user:user1")
+	second := limiter.Check("user:user1")
+	require.True(t, first > 0 && first <= time.Second)
+	require.True(t, second > time.Second && second <= 2*time.Second)
+
+	limiter.Fail("user:user1")
+	limiter.Fail("user:user1")
+	require.True(t, limiter.Check("user:user1") > 59*time.Minute)
+	require.Zero(t, limiter.Check("user:user2"))
+
+	limiter.Unlock("user:user1")
+	require.Zero(t, limiter.Check("user:user1"))
+
+	//the backoff stays at the lock duration however many failures precede the lockout
+	limiter = NewLoginLimiter(100, time.Second, time.Hour)
+	for i := 0; i < 70; i++ {
+		limiter.Fail("user:user1")
+		wait := limiter.Check("user:user1")
+		require.True(t, wait > 0 && wait <= time.Hour)
+	}
+	require.True(t, limiter.Check("user:user1") > 59*time.Minute)
+}
+
+func TestServerLoginLockout(t *testing.T) {
+	t.Parallel()
+
+	server := newTestAuthServer(t)
+	attacker := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}})
+	owner := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 1234}})
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+		_, err := server.Login(attacker, &pb.LoginRequest{Username: "user1", Password: "wrong"})
+		require.Equal(t, codes.NotFound, status.Code(err))
+	}
+
+	_, err := server.Login(owner, &pb.LoginRequest{Username: "user1", Password: "secret"})
+	st := status.Convert(err)
+	require.Equal(t, codes.ResourceExhausted, st.Code())
+	require.Len(t, st.Details(), 1)
+	retryInfo, ok := st.Details()[0].(*errdetails.RetryInfo)
+	require.True(t, ok)
+	require.True(t, retryInfo.GetRetryDelay().AsDuration() > 0)
+
+	userServer := NewUserServer(server.UserStore, server.PasswordHasher, server.RefreshTokenStore, server.RevocationStore, server.LoginLimiter, time.Minute)
+	_, err = userServer.UnlockUser(context.Background(), &pb.UnlockUserRequest{Username: "user1"})
+	require.NoError(t, err)
+
+	_, err = server.Login(owner, &pb.LoginRequest{Username: "user1", Password: "secret"})
+	require.NoError(t, err)
+
+	_, err = server.Login(attacker, &pb.LoginRequest{Username: "user1", Password: "secret"})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestServerLoginParallelGuesses(t *testing.T) {
+	t.Parallel()
+
+	server := newTestAuthServer(t)
+	attacker := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}})
+
+	const guesses = 10
+	start := make(chan struct{})
+	results := make(chan codes.Code, guesses)
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := server.Login(attacker, &pb.LoginRequest{Username: "user1", Password: "wrong"})
+			results <- status.Code(err)
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+	close(results)
+
+	//the guesses in flight count towards the lockout, so at most three passwords were checked
+	checked := 0
+	for code := range results {
+		if code == codes.NotFound {
+			checked++
+		}
+	}
+	require.True(t, checked > 0 && checked <= 3)
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/niroopreddym/interceptors-grpc-go/pb"
+	"github.com/niroopreddym/interceptors-grpc-go/store"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const timingSamples = 25
+
+//ksStatistic returns the two-sample Kolmogorov-Smirnov statistic, the largest distance between
+//the empirical distribution functions of the samples
+func ksStatistic(a []time.Duration, b []time.Duration) float64 {
+	sort.Slice(a, func(i, j int) bool { return a[i] < a[j] })
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+
+	var i, j int
+	var distance float64
+	for i < len(a) && j < len(b) {
+		if a[i] <= b[j] {
+			i++
+		} else {
+			j++
+		}
+
+		d := math.Abs(float64(i)/float64(len(a)) - float64(j)/float64(len(b)))
+		if d > distance {
+			distance = d
+		}
+	}
+
+	return distance
+}
+
+//ksCriticalValue is the distance above which two samples of size n come from
+//different distributions at a significance level of 0.001
+func ksCriticalValue(n int) float64 {
+	return 1.949 * math.Sqrt(2/float64(n))
+}
+
+func measure(f func()) time.Duration {
+	start := time.Now()
+	f()
+	return time.Since(start)
+}
+
+func TestServerLoginTiming(t *testing.T) {
+	if testing.Short() {
+		t.Skip("timing test is slow")
+	}
+
+	userStore := store.NewInMemoryUserStore()
+	passwordHasher := store.NewBcryptHasher(bcrypt.DefaultCost)
+	user, err := store.NewUser(passwordHasher, "user1", "secret", "user")
+	require.NoError(t, err)
+	require.NoError(t, userStore.Save(user))
+
+	//failures must not be throttled while sampling
+	limiter := NewLoginLimiter(math.MaxInt32, 0, time.Hour)
+	server := NewAuthServer(userStore, NewJWTManager("secret", time.Minute), passwordHasher, store.NewInMemoryRefreshTokenStore(), store.NewInMemoryRevocationStore(), limiter, time.Hour)
+	ctx := context.Background()
+
+	unknownUser := make([]time.Duration, timingSamples)
+	wrongPassword := make([]time.Duration, timingSamples)
+	lookupOnly := make([]time.Duration, timingSamples)
+
+	//interleave the paths so that load changes during the test affect them alike
+	for i := 0; i < timingSamples; i++ {
+		unknownUser[i] = measure(func() {
+			server.Login(ctx, &pb.LoginRequest{Username: "unknown", Password: "wrong"})
+		})
+		wrongPassword[i] = measure(func() {
+			server.Login(ctx, &pb.LoginRequest{Username: "user1", Password: "wrong"})
+		})
+		lookupOnly[i] = measure(func() {
+			userStore.Find("unknown")
+		})
+	}
+
+	//the harness must be able to tell a path without the password check apart
+	require.Greater(t, ksStatistic(lookupOnly, wrongPassword), ksCriticalValue(timingSamples))
+
+	distance := ksStatistic(unknownUser, wrongPassword)
+	t.Logf("ks distance between unknown user and wrong password: %.2f", distance)
+	require.Less(t, distance, ksCriticalValue(timingSamples))
+}
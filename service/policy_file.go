@@ -0,0 +1,101 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+//LoadAccessPolicy reads an access policy from a JSON or YAML file, the format is chosen by the file extension
+func LoadAccessPolicy(policyFile string) (*AccessPolicy, error) {
+	data, err := ioutil.ReadFile(policyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read policy file: %w", err)
+	}
+
+	return parseAccessPolicy(policyFile, data)
+}
+
+func parseAccessPolicy(policyFile string, data []byte) (*AccessPolicy, error) {
+	policy := &AccessPolicy{}
+
+	switch strings.ToLower(filepath.Ext(policyFile)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err := decoder.Decode(policy)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse yaml policy: %w", err)
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(policy)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse json policy: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported policy file extension: %s", filepath.Ext(policyFile))
+	}
+
+	err := policy.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid access policy: %w", err)
+	}
+
+	return policy, nil
+}
+
+//WatchPolicyFile polls the policy file every interval and swaps in the new policy when the file changes,
+//an invalid file is logged and the last good policy is kept, calling the returned func stops watching
+func (interceptor *AuthInterceptor) WatchPolicyFile(policyFile string, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	lastData, _ := ioutil.ReadFile(policyFile)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			data, err := ioutil.ReadFile(policyFile)
+			if err != nil {
+				log.Printf("cannot read policy file %s, keeping the current policy: %v", policyFile, err)
+				continue
+			}
+
+			if bytes.Equal(data, lastData) {
+				continue
+			}
+
+			lastData = data
+			policy, err := parseAccessPolicy(policyFile, data)
+			if err == nil {
+				err = interceptor.SetPolicy(policy)
+			}
+
+			if err != nil {
+				log.Printf("rejected policy file %s, keeping the current policy: %v", policyFile, err)
+				continue
+			}
+
+			log.Printf("reloaded access policy from %s", policyFile)
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/niroopreddym/interceptors-grpc-go/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAccessPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy, err := LoadAccessPolicy("../policy.yaml")
+	require.NoError(t, err)
+	require.NotNil(t, policy.rule("/pb.UserService/ListUsers"))
+
+	jsonFile := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, ioutil.WriteFile(jsonFile, []byte(`{"rules": [{"method": "/pb.LaptopService/*", "roles": ["admin"]}]}`), 0600))
+	policy, err = LoadAccessPolicy(jsonFile)
+	require.NoError(t, err)
+	require.Equal(t, []string{"admin"}, policy.rule("/pb.LaptopService/CreateLaptop").Roles)
+
+	require.NoError(t, ioutil.WriteFile(jsonFile, []byte(`{"rule": []}`), 0600))
+	_, err = LoadAccessPolicy(jsonFile)
+	require.Error(t, err)
+}
+
+func TestWatchPolicyFile(t *testing.T) {
+	t.Parallel()
+
+	policyFile := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, ioutil.WriteFile(policyFile, []byte("rules:\n  - method: /pb.LaptopService/CreateLaptop\n    roles: [admin]\n"), 0600))
+
+	policy, err := LoadAccessPolicy(policyFile)
+	require.NoError(t, err)
+
+	interceptor, err := NewAuthInterceptor(NewJWTManager("secret", time.Minute), store.NewInMemoryRevocationStore(), nil, policy)
+	require.NoError(t, err)
+
+	stop := interceptor.WatchPolicyFile(policyFile, 10*time.Millisecond)
+	defer stop()
+
+	require.NoError(t, ioutil.WriteFile(policyFile, []byte("rules:\n  - method: /pb.LaptopService/CreateLaptop\n    roles: [user]\n"), 0600))
+	require.Eventually(t, func() bool {
+		return interceptor.Policy().rule("/pb.LaptopService/CreateLaptop").Roles[0] == "user"
+	}, time.Second, 10*time.Millisecond)
+
+	current := interceptor.Policy()
+	require.NoError(t, ioutil.WriteFile(policyFile, []byte("rules:\n  - method: \"/pb.LaptopService/[\"\n"), 0600))
+	time.Sleep(100 * time.Millisecond)
+	require.Same(t, current, interceptor.Policy())
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/niroopreddym/interceptors-grpc-go/pb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+var (
+	protoRulesOnce sync.Once
+	protoRules     []AccessRule
+)
+
+//ProtoAccessRules returns the access rules declared with the (pb.auth) option on the RPCs of the registered proto files
+func ProtoAccessRules() []AccessRule {
+	protoRulesOnce.Do(func() {
+		protoregistry.GlobalFiles.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+			services := file.Services()
+			for i := 0; i < services.Len(); i++ {
+				methods := services.Get(i).Methods()
+				for j := 0; j < methods.Len(); j++ {
+					authRule := methodAuthRule(methods.Get(j))
+					if authRule == nil {
+						continue
+					}
+
+					protoRules = append(protoRules, AccessRule{
+						Method:      fmt.Sprintf("/%s/%s", services.Get(i).FullName(), methods.Get(j).Name()),
+						Public:      authRule.GetPublic(),
+						Authn:       strings.ToLower(authRule.GetAuthn().String()),
+						Roles:       authRule.GetRoles(),
+						Permissions: authRule.GetPermissions(),
+					})
+				}
+			}
+
+			return true
+		})
+
+		sort.Slice(protoRules, func(i, j int) bool {
+			return protoRules[i].Method < protoRules[j].Method
+		})
+	})
+
+	return protoRules
+}
+
+func methodAuthRule(method protoreflect.MethodDescriptor) *pb.AuthRule {
+	options, ok := method.Options().(*descriptorpb.MethodOptions)
+	if !ok || options == nil || !proto.HasExtension(options, pb.E_Auth) {
+		return nil
+	}
+
+	return proto.GetExtension(options, pb.E_Auth).(*pb.AuthRule)
+}
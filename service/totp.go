@@ -0,0 +1,104 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	totpDigits     = 6
+	totpPeriod     = 30 * time.Second
+	totpSkew       = 1
+	totpSecretSize = 20
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+//errInvalidOneTimeCode returns when the code does not match any accepted time step
+var errInvalidOneTimeCode = errors.New("one-time code is invalid")
+
+//newTOTPSecret returns a random base32 secret for the TOTP codes of a user
+func newTOTPSecret() (string, error) {
+	secret := make([]byte, totpSecretSize)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", fmt.Errorf("cannot generate totp secret: %w", err)
+	}
+
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+//totpURI returns the otpauth URI authenticator apps import the secret from
+func totpURI(issuer string, account string, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(int(totpPeriod/time.Second)))
+
+	uri := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+
+	return uri.String()
+}
+
+//totpCounter returns the RFC 6238 time step of the moment
+func totpCounter(now time.Time) int64 {
+	return now.Unix() / int64(totpPeriod/time.Second)
+}
+
+//hotp computes the RFC 4226 code of the counter with HMAC-SHA1
+func hotp(key []byte, counter int64, digits int) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%modulo)
+}
+
+//validateTOTP checks the code against the time steps around now, a step at or before lastCounter is
+//rejected so a code cannot be replayed, it returns the time step the code was accepted for
+func validateTOTP(secret string, code string, now time.Time, lastCounter int64) (int64, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, fmt.Errorf("totp secret is invalid: %w", err)
+	}
+
+	counter := totpCounter(now)
+	for step := counter - totpSkew; step <= counter+totpSkew; step++ {
+		if step <= lastCounter {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare([]byte(hotp(key, step, totpDigits)), []byte(code)) == 1 {
+			return step, nil
+		}
+	}
+
+	return 0, errInvalidOneTimeCode
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTPVectors(t *testing.T) {
+	t.Parallel()
+
+	//the SHA1 test vectors of RFC 6238 appendix B
+	key := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+
+	for unix, expected := range vectors {
+		require.Equal(t, expected, hotp(key, totpCounter(time.Unix(unix, 0)), 8))
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	t.Parallel()
+
+	secret, err := newTOTPSecret()
+	require.NoError(t, err)
+	key, err := totpEncoding.DecodeString(secret)
+	require.NoError(t, err)
+
+	now := time.Unix(1234567890, 0)
+	counter := totpCounter(now)
+
+	for _, step := range []int64{counter - 1, counter, counter + 1} {
+		accepted, err := validateTOTP(secret, hotp(key, step, totpDigits), now, 0)
+		require.NoError(t, err)
+		require.Equal(t, step, accepted)
+	}
+
+	_, err = validateTOTP(secret, hotp(key, counter+2, totpDigits), now, 0)
+	require.ErrorIs(t, err, errInvalidOneTimeCode)
+
+	_, err = validateTOTP(secret, hotp(key, counter, totpDigits), now, counter)
+	require.ErrorIs(t, err, errInvalidOneTimeCode)
+}
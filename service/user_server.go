@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/niroopreddym/interceptors-grpc-go/interceptors"
+	"github.com/niroopreddym/interceptors-grpc-go/pb"
+	"github.com/niroopreddym/interceptors-grpc-go/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//UserServer implements the user management RPCs, the tokens of a user are revoked when the password
+//or the roles change and when the user is deleted, PolicyProvider supplies the roles callers may grant
+type UserServer struct {
+	PolicyProvider    PolicyProvider
+	UserStore         store.UserStore
+	PasswordHasher    store.PasswordHasher
+	RefreshTokenStore store.RefreshTokenStore
+	RevocationStore   store.RevocationStore
+	LoginLimiter      *LoginLimiter
+	tokenDuration     time.Duration
+}
+
+//NewUserServer is the constructor for the user server, tokenDuration is the lifetime of the access
+//tokens after which their revocations are forgotten
+func NewUserServer(userStore store.UserStore, passwordHasher store.PasswordHasher, refreshTokenStore store.RefreshTokenStore, revocationStore store.RevocationStore, loginLimiter *LoginLimiter, tokenDuration time.Duration) *UserServer {
+	return &UserServer{
+		UserStore:         userStore,
+		PasswordHasher:    passwordHasher,
+		RefreshTokenStore: refreshTokenStore,
+		RevocationStore:   revocationStore,
+		LoginLimiter:      loginLimiter,
+		tokenDuration:     tokenDuration,
+	}
+}
+
+//RegisterUser creates a new user, the roles must be defined by the access policy and covered by the permissions of the caller
+func (server *UserServer) RegisterUser(ctx context.Context, req *pb.RegisterUserRequest) (*pb.RegisterUserResponse, error) {
+	if req.GetUsername() == "" || req.GetPassword() == "" || len(req.GetRoles()) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "username, password and roles must be provided")
+	}
+
+	err := server.checkRoles(ctx, req.GetRoles())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := store.NewUser(server.PasswordHasher, req.GetUsername(), req.GetPassword(), req.GetRoles()...)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot create user: %v", err)
+	}
+
+	user.Tenant = req.GetTenant()
+
+	err = server.UserStore.Save(user)
+	if err != nil {
+		return nil, storeError(err, "cannot save user")
+	}
+
+	interceptors.SetEvent(ctx, fmt.Sprintf("registered user %s of tenant %q with roles %v", user.UserName, user.Tenant, user.Roles))
+	res := &pb.RegisterUserResponse{
+		User: toPBUser(user),
+	}
+
+	return res, nil
+}
+
+//ListUsers lists all the users
+func (server *UserServer) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	users, err := server.UserStore.List()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot list users: %v", err)
+	}
+
+	res := &pb.ListUsersResponse{}
+	for _, user := range users {
+		res.Users = append(res.Users, toPBUser(user))
+	}
+
+	return res, nil
+}
+
+//ChangeRole replaces the roles of a user and revokes the tokens of the user since they carry the roles,
+//the roles must be defined by the access policy and covered by the permissions of the caller
+func (server *UserServer) ChangeRole(ctx context.Context, req *pb.ChangeRoleRequest) (*pb.ChangeRoleResponse, error) {
+	if len(req.GetRoles()) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "roles must be provided")
+	}
+
+	err := server.checkRoles(ctx, req.GetRoles())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := server.UserStore.Modify(req.GetUsername(), func(user *store.User) error {
+		user.Roles = req.GetRoles()
+		return nil
+	})
+	if err != nil {
+		return nil, storeError(err, "cannot update user")
+	}
+
+	err = server.revokeTokens(user.UserName)
+	if err != nil {
+		return nil, err
+	}
+
+	interceptors.SetEvent(ctx, fmt.Sprintf("changed roles of user %s to %v", user.UserName, user.Roles))
+	res := &pb.ChangeRoleResponse{
+		User: toPBUser(user),
+	}
+
+	return res, nil
+}
+
+//ResetPassword sets a new password for a user, clears the two-factor enrolment of the user so a
+//user who lost the authenticator can log in again and revokes the tokens of the user
+func (server *UserServer) ResetPassword(ctx context.Context, req *pb.ResetPasswordRequest) (*pb.ResetPasswordResponse, error) {
+	if req.GetNewPassword() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "new password must be provided")
+	}
+
+	err := server.updatePassword(req.GetUsername(), req.GetNewPassword(), "", true)
+	if err != nil {
+		return nil, err
+	}
+
+	interceptors.SetEvent(ctx, fmt.Sprintf("reset password of user %s", req.GetUsername()))
+	return &pb.ResetPasswordResponse{}, nil
+}
+
+//DeleteUser deletes a user and revokes the tokens of the user
+func (server *UserServer) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*pb.DeleteUserResponse, error) {
+	err := server.UserStore.Delete(req.GetUsername())
+	if err != nil {
+		return nil, storeError(err, "cannot delete user")
+	}
+
+	err = server.revokeTokens(req.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+
+	interceptors.SetEvent(ctx, fmt.Sprintf("deleted user %s", req.GetUsername()))
+	return &pb.DeleteUserResponse{}, nil
+}
+
+//UnlockUser clears the failed logins of a user so the account can log in again straight away
+func (server *UserServer) UnlockUser(ctx context.Context, req *pb.UnlockUserRequest) (*pb.UnlockUserResponse, error) {
+	_, err := server.findUser(req.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+
+	server.LoginLimiter.Unlock(userLimiterKey(req.GetUsername()))
+	interceptors.SetEvent(ctx, fmt.Sprintf("unlocked user %s", req.GetUsername()))
+	return &pb.UnlockUserResponse{}, nil
+}
+
+//ChangePassword changes the password of the calling user and revokes the tokens of the user, the
+//caller included, wrong old passwords are throttled like failed logins
+func (server *UserServer) ChangePassword(ctx context.Context, req *pb.ChangePasswordRequest) (*pb.ChangePasswordResponse, error) {
+	if req.GetNewPassword() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "new password must be provided")
+	}
+
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "changing the password needs the access token of the caller")
+	}
+
+	limiterKeys := []string{userLimiterKey(claims.Username), peerLimiterKey(ctx)}
+	release, wait := server.LoginLimiter.Begin(limiterKeys...)
+	defer release()
+	if wait > 0 {
+		return nil, retryError(wait)
+	}
+
+	user, err := server.findUser(claims.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.IsCorrectPassword(req.GetOldPassword()) {
+		server.LoginLimiter.Fail(limiterKeys...)
+		return nil, status.Errorf(codes.PermissionDenied, "incorrect password")
+	}
+
+	server.LoginLimiter.Unlock(userLimiterKey(user.UserName))
+	err = server.updatePassword(user.UserName, req.GetNewPassword(), user.HashedPassword, false)
+	if err != nil {
+		return nil, err
+	}
+
+	interceptors.SetEvent(ctx, fmt.Sprintf("user %s changed password", user.UserName))
+	return &pb.ChangePasswordResponse{}, nil
+}
+
+func (server *UserServer) checkRoles(ctx context.Context, roles []string) error {
+	for _, role := range roles {
+		err := checkGrantableRole(ctx, server.PolicyProvider, role)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (server *UserServer) findUser(userName string) (*store.User, error) {
+	user, err := server.UserStore.Find(userName)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find user: %v", err)
+	}
+
+	if user == nil {
+		return nil, status.Errorf(codes.NotFound, "user %s does not exist", userName)
+	}
+
+	return user, nil
+}
+
+//updatePassword replaces the password of the user and revokes the tokens of the user, when oldHash is
+//set the password is only replaced if the stored hash is still oldHash, clearTOTP also removes the
+//two-factor enrolment of the user
+func (server *UserServer) updatePassword(userName string, password string, oldHash string, clearTOTP bool) error {
+	hashedPassword, err := server.PasswordHasher.Hash(password)
+	if err != nil {
+		return status.Errorf(codes.Internal, "cannot set password: %v", err)
+	}
+
+	_, err = server.UserStore.Modify(userName, func(user *store.User) error {
+		if oldHash != "" && user.HashedPassword != oldHash {
+			return errPasswordChanged
+		}
+
+		user.HashedPassword = hashedPassword
+		if clearTOTP {
+			user.TOTPSecret = ""
+			user.TOTPEnabled = false
+			user.TOTPCounter = 0
+		}
+
+		return nil
+	})
+	if errors.Is(err, errPasswordChanged) {
+		return status.Errorf(codes.Aborted, "password of user %s changed concurrently", userName)
+	}
+
+	if err != nil {
+		return storeError(err, "cannot update user")
+	}
+
+	return server.revokeTokens(userName)
+}
+
+//revokeTokens revokes the refresh tokens of the user and the access tokens issued to the user so far
+func (server *UserServer) revokeTokens(userName string) error {
+	err := server.RefreshTokenStore.RevokeUser(userName)
+	if err != nil {
+		return status.Errorf(codes.Internal, "cannot revoke refresh tokens: %v", err)
+	}
+
+	now := time.Now()
+	err = server.RevocationStore.RevokeUser(userName, now, now.Add(server.tokenDuration))
+	if err != nil {
+		return status.Errorf(codes.Internal, "cannot revoke access tokens: %v", err)
+	}
+
+	return nil
+}
+
+func storeError(err error, message string) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, store.ErrAlreadyExists):
+		code = codes.AlreadyExists
+	case errors.Is(err, store.ErrNotFound):
+		code = codes.NotFound
+	}
+
+	return status.Errorf(code, "%s: %v", message, err)
+}
+
+func toPBUser(user *store.User) *pb.User {
+	return &pb.User{
+		Username:    user.UserName,
+		Roles:       user.Roles,
+		Tenant:      user.Tenant,
+		TotpEnabled: user.TOTPEnabled,
+	}
+}
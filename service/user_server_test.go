@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/niroopreddym/interceptors-grpc-go/pb"
+	"github.com/niroopreddym/interceptors-grpc-go/store"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerManageUsers(t *testing.T) {
+	t.Parallel()
+
+	userStore := store.NewInMemoryUserStore()
+	jwtManager := NewJWTManager("secret", time.Minute)
+	server := NewUserServer(userStore, store.NewBcryptHasher(bcrypt.DefaultCost), store.NewInMemoryRefreshTokenStore(), store.NewInMemoryRevocationStore(), NewLoginLimiter(3, time.Millisecond, time.Hour), time.Minute)
+	server.PolicyProvider = newTestPolicyProvider(t)
+	ctx := context.Background()
+	adminCtx := contextWithIdentity(ctx, &Identity{Principal: "admin1", Roles: []string{"admin"}})
+
+	_, err := server.RegisterUser(adminCtx, &pb.RegisterUserRequest{Username: "user2", Password: "secret", Roles: []string{"user"}})
+	require.NoError(t, err)
+
+	_, err = server.RegisterUser(adminCtx, &pb.RegisterUserRequest{Username: "user2", Password: "secret", Roles: []string{"user"}})
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	res, err := server.ChangeRole(adminCtx, &pb.ChangeRoleRequest{Username: "user2", Roles: []string{"user", "admin"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"user", "admin"}, res.GetUser().GetRoles())
+
+	//the roles must exist and must not grant more than the caller holds
+	_, err = server.RegisterUser(adminCtx, &pb.RegisterUserRequest{Username: "user3", Password: "secret", Roles: []string{"usr"}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	managerCtx := contextWithIdentity(ctx, &Identity{Principal: "manager1", Roles: []string{"manager"}})
+	_, err = server.RegisterUser(managerCtx, &pb.RegisterUserRequest{Username: "user3", Password: "secret", Roles: []string{"admin"}})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = server.ChangeRole(managerCtx, &pb.ChangeRoleRequest{Username: "manager1", Roles: []string{"manager", "admin"}})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	user, err := userStore.Find("user2")
+	require.NoError(t, err)
+	token, err := jwtManager.Generate(user)
+	require.NoError(t, err)
+
+	claims, err := jwtManager.Verify(token)
+	require.NoError(t, err)
+
+	_, err = server.ChangePassword(ctx, &pb.ChangePasswordRequest{OldPassword: "secret", NewPassword: "changed"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	userCtx := contextWithIdentity(ctx, &Identity{Principal: claims.Username, Roles: claims.Roles, Claims: claims})
+	_, err = server.ChangePassword(userCtx, &pb.ChangePasswordRequest{OldPassword: "wrong", NewPassword: "changed"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	//the wrong old password is throttled like a failed login
+	_, err = server.ChangePassword(userCtx, &pb.ChangePasswordRequest{OldPassword: "secret", NewPassword: "changed"})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	time.Sleep(10 * time.Millisecond)
+	_, err = server.ChangePassword(userCtx, &pb.ChangePasswordRequest{OldPassword: "secret", NewPassword: "changed"})
+	require.NoError(t, err)
+
+	user, err = userStore.Find("user2")
+	require.NoError(t, err)
+	require.True(t, user.IsCorrectPassword("changed"))
+
+	list, err := server.ListUsers(ctx, &pb.ListUsersRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.GetUsers(), 1)
+
+	_, err = server.DeleteUser(ctx, &pb.DeleteUserRequest{Username: "user2"})
+	require.NoError(t, err)
+
+	_, err = server.DeleteUser(ctx, &pb.DeleteUserRequest{Username: "user2"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+//newTestPolicyProvider provides a policy where managers may only manage users and admins may do everything
+func newTestPolicyProvider(t *testing.T) PolicyProvider {
+	interceptor, err := NewAuthInterceptor(NewJWTManager("secret", time.Minute), store.NewInMemoryRevocationStore(), nil, &AccessPolicy{
+		RolePermissions: map[string][]string{
+			"admin":   {"user:*", "laptop:*"},
+			"manager": {"user:manage"},
+			"user":    {"laptop:write"},
+		},
+	})
+	require.NoError(t, err)
+
+	return interceptor
+}
+
+func TestServerUserTokensRevoked(t *testing.T) {
+	t.Parallel()
+
+	authServer := newTestAuthServer(t)
+	authServer.LoginLimiter = NewLoginLimiter(10, 0, time.Hour)
+	server := NewUserServer(authServer.UserStore, authServer.PasswordHasher, authServer.RefreshTokenStore, authServer.RevocationStore, authServer.LoginLimiter, time.Minute)
+	server.PolicyProvider = newTestPolicyProvider(t)
+	interceptor, err := NewAuthInterceptor(authServer.jwtmanager, authServer.RevocationStore, nil, &AccessPolicy{
+		Rules: []AccessRule{{Method: "/pb.LaptopService/CreateLaptop", Roles: []string{"user"}}},
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	login, err := authServer.Login(ctx, &pb.LoginRequest{Username: "user1", Password: "secret"})
+	require.NoError(t, err)
+
+	tokenCtx := metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", login.GetAccessToken()))
+	_, err = interceptor.authorize(tokenCtx, "/pb.LaptopService/CreateLaptop")
+	require.NoError(t, err)
+
+	_, err = server.ResetPassword(ctx, &pb.ResetPasswordRequest{Username: "user1", NewPassword: "changed"})
+	require.NoError(t, err)
+
+	_, err = interceptor.authorize(tokenCtx, "/pb.LaptopService/CreateLaptop")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = authServer.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: login.GetRefreshToken()})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	//the tokens issued right after the revocation are accepted
+	login, err = authServer.Login(ctx, &pb.LoginRequest{Username: "user1", Password: "changed"})
+	require.NoError(t, err)
+
+	tokenCtx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", login.GetAccessToken()))
+	_, err = interceptor.authorize(tokenCtx, "/pb.LaptopService/CreateLaptop")
+	require.NoError(t, err)
+
+	//the roles are part of the tokens, which are revoked when the roles change
+	adminCtx := contextWithIdentity(ctx, &Identity{Principal: "admin1", Roles: []string{"admin"}})
+	_, err = server.ChangeRole(adminCtx, &pb.ChangeRoleRequest{Username: "user1", Roles: []string{"user"}})
+	require.NoError(t, err)
+
+	_, err = interceptor.authorize(tokenCtx, "/pb.LaptopService/CreateLaptop")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	login, err = authServer.Login(ctx, &pb.LoginRequest{Username: "user1", Password: "changed"})
+	require.NoError(t, err)
+
+	tokenCtx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", login.GetAccessToken()))
+	_, err = server.DeleteUser(ctx, &pb.DeleteUserRequest{Username: "user1"})
+	require.NoError(t, err)
+
+	_, err = interceptor.authorize(tokenCtx, "/pb.LaptopService/CreateLaptop")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = authServer.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: login.GetRefreshToken()})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
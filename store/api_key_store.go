@@ -0,0 +1,150 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+//APIKey stores the information of an issued API key, only the hash of the key is kept,
+//a zero ExpiresAt means the key does not expire and Tenant is the tenant of the creator
+type APIKey struct {
+	ID         string
+	Name       string
+	HashedKey  string
+	Role       string
+	Tenant     string
+	CreatedBy  string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+}
+
+//APIKeyStore stores the API keys
+type APIKeyStore interface {
+	Save(key *APIKey) error
+	Find(id string) (*APIKey, error)
+	FindByHash(hashedKey string) (*APIKey, error)
+	List() ([]*APIKey, error)
+	Delete(id string) error
+	Touch(id string, usedAt time.Time) error
+}
+
+//InMemoryAPIKeyStore stores the API keys in memory
+type InMemoryAPIKeyStore struct {
+	mutex  sync.RWMutex
+	keys   map[string]*APIKey
+	hashes map[string]string
+}
+
+//NewInMemoryAPIKeyStore returns a new InMemoryAPIKeyStore
+func NewInMemoryAPIKeyStore() *InMemoryAPIKeyStore {
+	return &InMemoryAPIKeyStore{
+		keys:   make(map[string]*APIKey),
+		hashes: make(map[string]string),
+	}
+}
+
+//Save saves the API key
+func (store *InMemoryAPIKeyStore) Save(key *APIKey) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.keys[key.ID] != nil || store.hashes[key.HashedKey] != "" {
+		return ErrAlreadyExists
+	}
+
+	store.keys[key.ID] = key.Clone()
+	store.hashes[key.HashedKey] = key.ID
+	return nil
+}
+
+//Find finds the API key by id
+func (store *InMemoryAPIKeyStore) Find(id string) (*APIKey, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	key := store.keys[id]
+	if key == nil {
+		return nil, nil
+	}
+
+	return key.Clone(), nil
+}
+
+//FindByHash finds the API key by the hash of the key
+func (store *InMemoryAPIKeyStore) FindByHash(hashedKey string) (*APIKey, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	key := store.keys[store.hashes[hashedKey]]
+	if key == nil {
+		return nil, nil
+	}
+
+	return key.Clone(), nil
+}
+
+//List returns all the API keys sorted by name
+func (store *InMemoryAPIKeyStore) List() ([]*APIKey, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	keys := make([]*APIKey, 0, len(store.keys))
+	for _, key := range store.keys {
+		keys = append(keys, key.Clone())
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Name != keys[j].Name {
+			return keys[i].Name < keys[j].Name
+		}
+		return keys[i].ID < keys[j].ID
+	})
+
+	return keys, nil
+}
+
+//Delete deletes the API key
+func (store *InMemoryAPIKeyStore) Delete(id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	key := store.keys[id]
+	if key == nil {
+		return ErrNotFound
+	}
+
+	delete(store.hashes, key.HashedKey)
+	delete(store.keys, id)
+	return nil
+}
+
+//Touch records the last use of the API key
+func (store *InMemoryAPIKeyStore) Touch(id string, usedAt time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	key := store.keys[id]
+	if key == nil {
+		return ErrNotFound
+	}
+
+	key.LastUsedAt = usedAt
+	return nil
+}
+
+//Clone clones the API key
+func (key *APIKey) Clone() *APIKey {
+	return &APIKey{
+		ID:         key.ID,
+		Name:       key.Name,
+		HashedKey:  key.HashedKey,
+		Role:       key.Role,
+		Tenant:     key.Tenant,
+		CreatedBy:  key.CreatedBy,
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+	}
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+//AuditEntry records a RPC that Actor ran as the user Subject
+type AuditEntry struct {
+	Time    time.Time
+	Actor   string
+	Subject string
+	Method  string
+	Code    string
+}
+
+//AuditFilter selects audit entries, zero fields match every entry and a zero Limit returns all matches
+type AuditFilter struct {
+	Actor   string
+	Subject string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+}
+
+//AuditStore stores the audit log
+type AuditStore interface {
+	Append(entry *AuditEntry) error
+	Query(filter AuditFilter) ([]*AuditEntry, error)
+}
+
+//InMemoryAuditStore stores the audit log in memory
+type InMemoryAuditStore struct {
+	mutex   sync.RWMutex
+	entries []*AuditEntry
+}
+
+//NewInMemoryAuditStore returns a new InMemoryAuditStore
+func NewInMemoryAuditStore() *InMemoryAuditStore {
+	return &InMemoryAuditStore{}
+}
+
+//Append appends the entry to the audit log
+func (store *InMemoryAuditStore) Append(entry *AuditEntry) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	other := *entry
+	store.entries = append(store.entries, &other)
+	return nil
+}
+
+//Query returns the entries matching the filter, the most recent first
+func (store *InMemoryAuditStore) Query(filter AuditFilter) ([]*AuditEntry, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	var entries []*AuditEntry
+	for i := len(store.entries) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+
+		entry := store.entries[i]
+		if filter.Actor != "" && entry.Actor != filter.Actor {
+			continue
+		}
+
+		if filter.Subject != "" && entry.Subject != filter.Subject {
+			continue
+		}
+
+		if !filter.Since.IsZero() && entry.Time.Before(filter.Since) {
+			continue
+		}
+
+		if !filter.Until.IsZero() && entry.Time.After(filter.Until) {
+			continue
+		}
+
+		other := *entry
+		entries = append(entries, &other)
+	}
+
+	return entries, nil
+}
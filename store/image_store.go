@@ -3,24 +3,26 @@ package store
 import (
 	"bytes"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/google/uuid"
 )
 
-//ImageStore is an interface to store laptop images
+//ImageStore is an interface to store laptop images, the images of each tenant are kept apart
 type ImageStore interface {
-	Save(laptopID string, imageType string, imageData bytes.Buffer) (string, error)
+	Save(tenant string, laptopID string, imageType string, imageData bytes.Buffer) (string, error)
+	Find(tenant string, imageID string) (*ImageInfo, error)
 }
 
-//DiskImageStore is a struct to store image data
+//DiskImageStore is a struct to store image data, the images of a tenant
+//are written to a sub folder named after the tenant
 type DiskImageStore struct {
 	mutex       sync.RWMutex
 	imageFolder string
-	images      map[string]*ImageInfo
+	images      map[string]map[string]*ImageInfo
 }
 
 //ImageInfo is a struct
@@ -34,25 +36,34 @@ type ImageInfo struct {
 func NewDiskImageStore(imageFolder string) DiskImageStore {
 	return DiskImageStore{
 		imageFolder: imageFolder,
-		images:      map[string]*ImageInfo{},
+		images:      map[string]map[string]*ImageInfo{},
 	}
 }
 
 //Save saves teh image to the idsk location
-func (store *DiskImageStore) Save(laptopID string, imageType string, imageData bytes.Buffer) (string, error) {
+func (store *DiskImageStore) Save(tenant string, laptopID string, imageType string, imageData bytes.Buffer) (string, error) {
+	if tenant == "." || tenant == ".." || strings.ContainsAny(tenant, `/\`) {
+		return "", fmt.Errorf("invalid tenant name: %q", tenant)
+	}
+
 	imageID, err := uuid.NewRandom()
 	if err != nil {
 		return "", fmt.Errorf("cannot generate image id : %w", err)
 	}
 
+	tenantFolder := filepath.Join(store.imageFolder, tenant)
+	err = os.MkdirAll(tenantFolder, 0755)
+	if err != nil {
+		return "", fmt.Errorf("cannot create image folder: %w", err)
+	}
+
 	// imagePath := fmt.Sprintf("image path %s/%s%s", store.imageFolder, imageID, imageType)
-	imagePath := filepath.Join(store.imageFolder, imageID.String()+imageType)
+	imagePath := filepath.Join(tenantFolder, imageID.String()+imageType)
 	file, err := os.Create(imagePath)
 	if err != nil {
 		return "", fmt.Errorf("cannot create image file: %w", err)
 	}
 
-	log.Print("filepath is: ", imagePath)
 	_, err = imageData.WriteTo(file)
 	if err != nil {
 		return "", fmt.Errorf("cannot write image to file: %w", err)
@@ -61,7 +72,11 @@ func (store *DiskImageStore) Save(laptopID string, imageType string, imageData b
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
-	store.images[imageID.String()] = &ImageInfo{
+	if store.images[tenant] == nil {
+		store.images[tenant] = make(map[string]*ImageInfo)
+	}
+
+	store.images[tenant][imageID.String()] = &ImageInfo{
 		LaptopID: laptopID,
 		Type:     imageType,
 		Path:     imagePath,
@@ -69,3 +84,17 @@ func (store *DiskImageStore) Save(laptopID string, imageType string, imageData b
 
 	return imageID.String(), nil
 }
+
+//Find finds the image of the tenant by id
+func (store *DiskImageStore) Find(tenant string, imageID string) (*ImageInfo, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	info := store.images[tenant][imageID]
+	if info == nil {
+		return nil, nil
+	}
+
+	other := *info
+	return &other, nil
+}
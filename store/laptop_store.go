@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"sync"
 
 	"github.com/jinzhu/copier"
@@ -14,32 +13,36 @@ import (
 //ErrAlreadyExists returns if the laptop with same id already exists in the store
 var ErrAlreadyExists = errors.New("error already exists")
 
-//LaptopStore proides an interface to save the laptop data
+//ErrNotFound returns if the record to update or delete does not exist in the store
+var ErrNotFound = errors.New("error not found")
+
+//LaptopStore proides an interface to save the laptop data, the laptops of
+//a tenant are invisible to the other tenants
 type LaptopStore interface {
-	Save(laptop *pb.Laptop) error
-	Find(id string) (*pb.Laptop, error)
-	Search(ctx context.Context, filter *pb.Filter, found func(laptop *pb.Laptop) error) error
+	Save(tenant string, laptop *pb.Laptop) error
+	Find(tenant string, id string) (*pb.Laptop, error)
+	Search(ctx context.Context, tenant string, filter *pb.Filter, found func(laptop *pb.Laptop) error) error
 }
 
 //InMemoryLaptopStore proides an interface to save the laptop data to in memory store
 type InMemoryLaptopStore struct {
 	mutex sync.RWMutex
-	data  map[string]*pb.Laptop
+	data  map[string]map[string]*pb.Laptop
 }
 
 //NewInMemoryLaptopStore returns a new InMemoryLaptopStore
 func NewInMemoryLaptopStore() *InMemoryLaptopStore {
 	return &InMemoryLaptopStore{
-		data: make(map[string]*pb.Laptop),
+		data: make(map[string]map[string]*pb.Laptop),
 	}
 }
 
-//Save saves the laptop to the store
-func (store *InMemoryLaptopStore) Save(laptop *pb.Laptop) error {
+//Save saves the laptop to the store of the tenant
+func (store *InMemoryLaptopStore) Save(tenant string, laptop *pb.Laptop) error {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
-	if store.data[laptop.Id] != nil {
+	if store.data[tenant][laptop.Id] != nil {
 		return ErrAlreadyExists
 	}
 
@@ -49,16 +52,20 @@ func (store *InMemoryLaptopStore) Save(laptop *pb.Laptop) error {
 		return err
 	}
 
-	store.data[other.Id] = other
+	if store.data[tenant] == nil {
+		store.data[tenant] = make(map[string]*pb.Laptop)
+	}
+
+	store.data[tenant][other.Id] = other
 	return nil
 }
 
-//Find finds a laptop by ID
-func (store *InMemoryLaptopStore) Find(id string) (*pb.Laptop, error) {
+//Find finds a laptop of the tenant by ID
+func (store *InMemoryLaptopStore) Find(tenant string, id string) (*pb.Laptop, error) {
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
 
-	laptop := store.data[id]
+	laptop := store.data[tenant][id]
 	if laptop == nil {
 		return nil, nil
 	}
@@ -67,18 +74,16 @@ func (store *InMemoryLaptopStore) Find(id string) (*pb.Laptop, error) {
 	return deepCopy(laptop)
 }
 
-//Search searches the in memory data store
-func (store *InMemoryLaptopStore) Search(ctx context.Context, filter *pb.Filter, found func(laptop *pb.Laptop) error) error {
+//Search searches the laptops of the tenant in the in memory data store
+func (store *InMemoryLaptopStore) Search(ctx context.Context, tenant string, filter *pb.Filter, found func(laptop *pb.Laptop) error) error {
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
 
-	for _, laptop := range store.data {
+	for _, laptop := range store.data[tenant] {
 		// time.Sleep(1 * time.Second)
-		log.Print("checking laptop id: ", laptop.GetId())
 
 		//check the context
 		if ctx.Err() == context.DeadlineExceeded || ctx.Err() == context.Canceled {
-			log.Print("Context is cancelled")
 			return errors.New("context is cancelled")
 		}
 
@@ -0,0 +1,260 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	passwordSaltSize = 16
+	passwordKeySize  = 32
+)
+
+//ErrUnknownPasswordHash returns if the stored hash is not in a format of the password hashers
+var ErrUnknownPasswordHash = errors.New("unknown password hash format")
+
+//PasswordHasher hashes passwords into self-describing strings, NeedsRehash tells whether a stored
+//hash was made with another algorithm or other parameters than the hasher uses now
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	NeedsRehash(hashedPassword string) bool
+}
+
+//NewPasswordHasher returns the hasher of the algorithm with the default parameters,
+//the algorithm is one of bcrypt, scrypt and argon2id
+func NewPasswordHasher(algorithm string) (PasswordHasher, error) {
+	switch algorithm {
+	case "bcrypt":
+		return NewBcryptHasher(bcrypt.DefaultCost), nil
+	case "scrypt":
+		return NewScryptHasher(1<<15, 8, 1), nil
+	case "argon2id":
+		return NewArgon2idHasher(3, 64*1024, 4), nil
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", algorithm)
+	}
+}
+
+//VerifyPassword checks the password against a hash produced by any of the password hashers
+func VerifyPassword(hashedPassword string, password string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hashedPassword, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+
+		return err == nil, err
+	case strings.HasPrefix(hashedPassword, "$scrypt$"):
+		params, salt, key, err := parseScryptHash(hashedPassword)
+		if err != nil {
+			return false, err
+		}
+
+		other, err := scrypt.Key([]byte(password), salt, params.n, params.r, params.p, len(key))
+		if err != nil {
+			return false, fmt.Errorf("cannot hash password: %w", err)
+		}
+
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	case strings.HasPrefix(hashedPassword, "$argon2id$"):
+		params, salt, key, err := parseArgon2idHash(hashedPassword)
+		if err != nil {
+			return false, err
+		}
+
+		other := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	default:
+		return false, ErrUnknownPasswordHash
+	}
+}
+
+//BcryptHasher hashes passwords with bcrypt at the cost
+type BcryptHasher struct {
+	cost int
+}
+
+//NewBcryptHasher returns a new BcryptHasher
+func NewBcryptHasher(cost int) *BcryptHasher {
+	return &BcryptHasher{
+		cost: cost,
+	}
+}
+
+//Hash hashes the password in the modular crypt format of bcrypt
+func (hasher *BcryptHasher) Hash(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), hasher.cost)
+	if err != nil {
+		return "", fmt.Errorf("cannot hash password: %w", err)
+	}
+
+	return string(hashedPassword), nil
+}
+
+//NeedsRehash tells whether the hash is not a bcrypt hash of the cost of the hasher
+func (hasher *BcryptHasher) NeedsRehash(hashedPassword string) bool {
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	return err != nil || cost != hasher.cost
+}
+
+//ScryptHasher hashes passwords with scrypt, n is the CPU and memory cost and must be a power of two
+type ScryptHasher struct {
+	params scryptParams
+}
+
+type scryptParams struct {
+	n int
+	r int
+	p int
+}
+
+//NewScryptHasher returns a new ScryptHasher
+func NewScryptHasher(n int, r int, p int) *ScryptHasher {
+	return &ScryptHasher{
+		params: scryptParams{n: n, r: r, p: p},
+	}
+}
+
+//Hash hashes the password in the PHC string format $scrypt$ln=<log2 n>,r=<r>,p=<p>$<salt>$<key>
+func (hasher *ScryptHasher) Hash(password string) (string, error) {
+	params := hasher.params
+	if params.n < 2 || params.n&(params.n-1) != 0 {
+		return "", fmt.Errorf("scrypt cost %d is not a power of two", params.n)
+	}
+
+	salt, err := passwordSalt()
+	if err != nil {
+		return "", err
+	}
+
+	key, err := scrypt.Key([]byte(password), salt, params.n, params.r, params.p, passwordKeySize)
+	if err != nil {
+		return "", fmt.Errorf("cannot hash password: %w", err)
+	}
+
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", bits.TrailingZeros(uint(params.n)), params.r, params.p, encodeHashPart(salt), encodeHashPart(key)), nil
+}
+
+//NeedsRehash tells whether the hash is not a scrypt hash of the parameters of the hasher
+func (hasher *ScryptHasher) NeedsRehash(hashedPassword string) bool {
+	params, _, key, err := parseScryptHash(hashedPassword)
+	return err != nil || params != hasher.params || len(key) != passwordKeySize
+}
+
+func parseScryptHash(hashedPassword string) (scryptParams, []byte, []byte, error) {
+	var params scryptParams
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 5 || parts[1] != "scrypt" {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	var logN uint
+	_, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &logN, &params.r, &params.p)
+	if err != nil || logN < 1 || logN > 30 {
+		return params, nil, nil, fmt.Errorf("scrypt parameters are invalid: %s", parts[2])
+	}
+
+	params.n = 1 << logN
+	salt, key, err := decodeHashParts(parts[3], parts[4])
+	return params, salt, key, err
+}
+
+//Argon2idHasher hashes passwords with argon2id, memory is in KiB
+type Argon2idHasher struct {
+	params argon2idParams
+}
+
+type argon2idParams struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+//NewArgon2idHasher returns a new Argon2idHasher
+func NewArgon2idHasher(time uint32, memory uint32, threads uint8) *Argon2idHasher {
+	return &Argon2idHasher{
+		params: argon2idParams{time: time, memory: memory, threads: threads},
+	}
+}
+
+//Hash hashes the password in the PHC string format $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+func (hasher *Argon2idHasher) Hash(password string) (string, error) {
+	params := hasher.params
+	if params.time < 1 || params.threads < 1 {
+		return "", fmt.Errorf("argon2id time and threads must be positive")
+	}
+
+	salt, err := passwordSalt()
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, passwordKeySize)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, params.memory, params.time, params.threads, encodeHashPart(salt), encodeHashPart(key)), nil
+}
+
+//NeedsRehash tells whether the hash is not an argon2id hash of the parameters of the hasher
+func (hasher *Argon2idHasher) NeedsRehash(hashedPassword string) bool {
+	params, _, key, err := parseArgon2idHash(hashedPassword)
+	return err != nil || params != hasher.params || len(key) != passwordKeySize
+}
+
+func parseArgon2idHash(hashedPassword string) (argon2idParams, []byte, []byte, error) {
+	var params argon2idParams
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("argon2id version is not supported: %s", parts[2])
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads)
+	if err != nil || params.time < 1 || params.threads < 1 {
+		return params, nil, nil, fmt.Errorf("argon2id parameters are invalid: %s", parts[3])
+	}
+
+	salt, key, err := decodeHashParts(parts[4], parts[5])
+	return params, salt, key, err
+}
+
+func passwordSalt() ([]byte, error) {
+	salt := make([]byte, passwordSaltSize)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate salt: %w", err)
+	}
+
+	return salt, nil
+}
+
+func encodeHashPart(data []byte) string {
+	return base64.RawStdEncoding.EncodeToString(data)
+}
+
+func decodeHashParts(encodedSalt string, encodedKey string) ([]byte, []byte, error) {
+	salt, err := base64.RawStdEncoding.DecodeString(encodedSalt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot decode salt: %w", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) == 0 {
+		return nil, nil, fmt.Errorf("cannot decode key: %v", err)
+	}
+
+	return salt, key, nil
+}
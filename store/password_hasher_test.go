@@ -0,0 +1,71 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHashers(t *testing.T) {
+	t.Parallel()
+
+	hashers := map[string]PasswordHasher{
+		"$2a$":                         NewBcryptHasher(bcrypt.MinCost),
+		"$scrypt$ln=10,r=8,p=1$":       NewScryptHasher(1<<10, 8, 1),
+		"$argon2id$v=19$m=64,t=1,p=1$": NewArgon2idHasher(1, 64, 1),
+	}
+
+	for prefix, hasher := range hashers {
+		hashedPassword, err := hasher.Hash("secret")
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(hashedPassword, prefix), hashedPassword)
+
+		other, err := hasher.Hash("secret")
+		require.NoError(t, err)
+		require.NotEqual(t, hashedPassword, other)
+
+		ok, err := VerifyPassword(hashedPassword, "secret")
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		ok, err = VerifyPassword(hashedPassword, "wrong")
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		require.False(t, hasher.NeedsRehash(hashedPassword))
+		for _, otherHasher := range hashers {
+			if otherHasher != hasher {
+				require.True(t, otherHasher.NeedsRehash(hashedPassword))
+			}
+		}
+	}
+
+	_, err := VerifyPassword("plain", "plain")
+	require.ErrorIs(t, err, ErrUnknownPasswordHash)
+}
+
+func TestPasswordHasherParameters(t *testing.T) {
+	t.Parallel()
+
+	hashedPassword, err := NewBcryptHasher(bcrypt.MinCost).Hash("secret")
+	require.NoError(t, err)
+	require.True(t, NewBcryptHasher(bcrypt.MinCost+1).NeedsRehash(hashedPassword))
+
+	hashedPassword, err = NewScryptHasher(1<<10, 8, 1).Hash("secret")
+	require.NoError(t, err)
+	require.True(t, NewScryptHasher(1<<11, 8, 1).NeedsRehash(hashedPassword))
+	require.True(t, NewScryptHasher(1<<10, 8, 2).NeedsRehash(hashedPassword))
+
+	hashedPassword, err = NewArgon2idHasher(1, 64, 1).Hash("secret")
+	require.NoError(t, err)
+	require.True(t, NewArgon2idHasher(2, 64, 1).NeedsRehash(hashedPassword))
+	require.True(t, NewArgon2idHasher(1, 128, 1).NeedsRehash(hashedPassword))
+
+	_, err = NewScryptHasher(1000, 8, 1).Hash("secret")
+	require.Error(t, err)
+
+	_, err = NewPasswordHasher("md5")
+	require.Error(t, err)
+}
@@ -4,9 +4,9 @@ import (
 	"sync"
 )
 
-//RatingStore rates the laptop
+//RatingStore rates the laptop, the ratings of each tenant are kept apart
 type RatingStore interface {
-	Add(laptopID string, score float64) (*Rating, error)
+	Add(tenant string, laptopID string, score float64) (*Rating, error)
 }
 
 //Rating contains the rating information
@@ -18,22 +18,26 @@ type Rating struct {
 //InMemoryRatingScore stores the laptop ratingsin memory
 type InMemoryRatingScore struct {
 	mutex  sync.RWMutex
-	rating map[string]*Rating
+	rating map[string]map[string]*Rating
 }
 
 //NewInMemoryRatingStore returns a new InMemoryRatingStore
 func NewInMemoryRatingStore() *InMemoryRatingScore {
 	return &InMemoryRatingScore{
-		rating: make(map[string]*Rating),
+		rating: make(map[string]map[string]*Rating),
 	}
 }
 
-//Add adds a new laptop score to the store and returns the rating
-func (store *InMemoryRatingScore) Add(laptopID string, score float64) (*Rating, error) {
+//Add adds a new laptop score of the tenant to the store and returns the rating
+func (store *InMemoryRatingScore) Add(tenant string, laptopID string, score float64) (*Rating, error) {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
-	rating := store.rating[laptopID]
+	if store.rating[tenant] == nil {
+		store.rating[tenant] = make(map[string]*Rating)
+	}
+
+	rating := store.rating[tenant][laptopID]
 	if rating == nil {
 		rating = &Rating{
 			Count: 1,
@@ -44,6 +48,6 @@ func (store *InMemoryRatingScore) Add(laptopID string, score float64) (*Rating,
 		rating.Sum += score
 	}
 
-	store.rating[laptopID] = rating
-	return rating, nil
+	store.rating[tenant][laptopID] = rating
+	return &Rating{Count: rating.Count, Sum: rating.Sum}, nil
 }
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+//RefreshToken stores the information of an issued refresh token, only the hash of the token is kept,
+//CertThumbprint is set when the token may only be used with that client certificate
+type RefreshToken struct {
+	ID             string
+	Family         string
+	UserName       string
+	CertThumbprint string
+	ExpiresAt      time.Time
+	Used           bool
+}
+
+//RefreshTokenStore stores the refresh tokens
+type RefreshTokenStore interface {
+	Save(token *RefreshToken) error
+	Find(id string) (*RefreshToken, error)
+	Use(id string) (*RefreshToken, error)
+	RevokeFamily(family string) error
+	RevokeUser(userName string) error
+}
+
+//InMemoryRefreshTokenStore stores the refresh tokens in memory
+type InMemoryRefreshTokenStore struct {
+	mutex  sync.Mutex
+	tokens map[string]*RefreshToken
+}
+
+//NewInMemoryRefreshTokenStore returns a new InMemoryRefreshTokenStore
+func NewInMemoryRefreshTokenStore() *InMemoryRefreshTokenStore {
+	return &InMemoryRefreshTokenStore{
+		tokens: make(map[string]*RefreshToken),
+	}
+}
+
+//Save saves the refresh token and drops the expired ones
+func (store *InMemoryRefreshTokenStore) Save(token *RefreshToken) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.tokens[token.ID] != nil {
+		return ErrAlreadyExists
+	}
+
+	now := time.Now()
+	for id, other := range store.tokens {
+		if now.After(other.ExpiresAt) {
+			delete(store.tokens, id)
+		}
+	}
+
+	store.tokens[token.ID] = token.Clone()
+	return nil
+}
+
+//Find finds the refresh token by id
+func (store *InMemoryRefreshTokenStore) Find(id string) (*RefreshToken, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	token := store.tokens[id]
+	if token == nil {
+		return nil, nil
+	}
+
+	return token.Clone(), nil
+}
+
+//Use marks the refresh token as used and returns it as it was before, nil if it does not exist
+func (store *InMemoryRefreshTokenStore) Use(id string) (*RefreshToken, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	token := store.tokens[id]
+	if token == nil {
+		return nil, nil
+	}
+
+	other := token.Clone()
+	token.Used = true
+	return other, nil
+}
+
+//RevokeFamily deletes every refresh token rotated from the same login
+func (store *InMemoryRefreshTokenStore) RevokeFamily(family string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for id, token := range store.tokens {
+		if token.Family == family {
+			delete(store.tokens, id)
+		}
+	}
+
+	return nil
+}
+
+//RevokeUser deletes every refresh token of the user, whichever login it was rotated from
+func (store *InMemoryRefreshTokenStore) RevokeUser(userName string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for id, token := range store.tokens {
+		if token.UserName == userName {
+			delete(store.tokens, id)
+		}
+	}
+
+	return nil
+}
+
+//Clone clones the refresh token
+func (token *RefreshToken) Clone() *RefreshToken {
+	return &RefreshToken{
+		ID:             token.ID,
+		Family:         token.Family,
+		UserName:       token.UserName,
+		CertThumbprint: token.CertThumbprint,
+		ExpiresAt:      token.ExpiresAt,
+		Used:           token.Used,
+	}
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+//RevocationStore stores the ids of the revoked access tokens and the users whose access tokens
+//issued up to a moment are all revoked
+type RevocationStore interface {
+	Revoke(id string, expiresAt time.Time) error
+	IsRevoked(id string) (bool, error)
+	RevokeUser(userName string, issuedBefore time.Time, expiresAt time.Time) error
+	IsUserRevoked(userName string, issuedAt time.Time) (bool, error)
+}
+
+//InMemoryRevocationStore stores the revoked token ids and users in memory until the tokens expire
+type InMemoryRevocationStore struct {
+	mutex        sync.RWMutex
+	revoked      map[string]time.Time
+	revokedUsers map[string]userRevocation
+}
+
+//userRevocation revokes the tokens of a user issued up to issuedBefore, which have all expired by expiresAt
+type userRevocation struct {
+	issuedBefore time.Time
+	expiresAt    time.Time
+}
+
+//NewInMemoryRevocationStore returns a new InMemoryRevocationStore
+func NewInMemoryRevocationStore() *InMemoryRevocationStore {
+	return &InMemoryRevocationStore{
+		revoked:      make(map[string]time.Time),
+		revokedUsers: make(map[string]userRevocation),
+	}
+}
+
+//Revoke revokes the token id, the entry is dropped once the token has expired
+func (store *InMemoryRevocationStore) Revoke(id string, expiresAt time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := time.Now()
+	store.dropExpired(now)
+	if now.After(expiresAt) {
+		return nil
+	}
+
+	store.revoked[id] = expiresAt
+	return nil
+}
+
+//IsRevoked checks whether the token id has been revoked
+func (store *InMemoryRevocationStore) IsRevoked(id string) (bool, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	expiresAt, ok := store.revoked[id]
+	if !ok {
+		return false, nil
+	}
+
+	return time.Now().Before(expiresAt), nil
+}
+
+//RevokeUser revokes the access tokens of the user issued up to issuedBefore, the entry is dropped
+//at expiresAt when all these tokens have expired
+func (store *InMemoryRevocationStore) RevokeUser(userName string, issuedBefore time.Time, expiresAt time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := time.Now()
+	store.dropExpired(now)
+	if now.After(expiresAt) {
+		return nil
+	}
+
+	revocation := store.revokedUsers[userName]
+	if issuedBefore.After(revocation.issuedBefore) {
+		revocation.issuedBefore = issuedBefore
+	}
+
+	if expiresAt.After(revocation.expiresAt) {
+		revocation.expiresAt = expiresAt
+	}
+
+	store.revokedUsers[userName] = revocation
+	return nil
+}
+
+//IsUserRevoked checks whether the access tokens of the user issued at the moment have been revoked
+func (store *InMemoryRevocationStore) IsUserRevoked(userName string, issuedAt time.Time) (bool, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	revocation, ok := store.revokedUsers[userName]
+	if !ok || time.Now().After(revocation.expiresAt) {
+		return false, nil
+	}
+
+	return !issuedAt.After(revocation.issuedBefore), nil
+}
+
+func (store *InMemoryRevocationStore) dropExpired(now time.Time) {
+	for id, expiresAt := range store.revoked {
+		if now.After(expiresAt) {
+			delete(store.revoked, id)
+		}
+	}
+
+	for userName, revocation := range store.revokedUsers {
+		if now.After(revocation.expiresAt) {
+			delete(store.revokedUsers, userName)
+		}
+	}
+}
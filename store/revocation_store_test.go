@@ -0,0 +1,38 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevocationStoreRevokeUser(t *testing.T) {
+	t.Parallel()
+
+	revocationStore := NewInMemoryRevocationStore()
+	now := time.Now()
+	require.NoError(t, revocationStore.RevokeUser("user1", now, now.Add(time.Hour)))
+
+	revoked, err := revocationStore.IsUserRevoked("user1", now.Add(-time.Nanosecond))
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	//the tokens issued within the same second but after the revocation are accepted
+	revoked, err = revocationStore.IsUserRevoked("user1", now.Add(time.Nanosecond))
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	revoked, err = revocationStore.IsUserRevoked("user2", now.Add(-time.Nanosecond))
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	//the entries are dropped once the tokens they revoke have expired
+	require.NoError(t, revocationStore.RevokeUser("user2", now, now.Add(-time.Second)))
+	require.NoError(t, revocationStore.RevokeUser("user3", now, now.Add(time.Millisecond)))
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, revocationStore.Revoke("token", now.Add(time.Hour)))
+	require.NotContains(t, revocationStore.revokedUsers, "user2")
+	require.NotContains(t, revocationStore.revokedUsers, "user3")
+	require.Contains(t, revocationStore.revokedUsers, "user1")
+}
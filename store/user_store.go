@@ -1,23 +1,31 @@
 package store
 
 import (
-	"fmt"
+	"sort"
 	"sync"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
-//User stores user's information
+//User stores user's information, Tenant is the business unit whose data the user works with,
+//TOTPSecret is the base32 secret of the two-factor codes which only has to be presented at login
+//once TOTPEnabled is set and TOTPCounter is the time step of the last code accepted
 type User struct {
 	UserName       string
 	HashedPassword string
-	Role           string
+	Roles          []string
+	Tenant         string
+	TOTPSecret     string
+	TOTPEnabled    bool
+	TOTPCounter    int64
 }
 
 //UserStore stores the user dta
 type UserStore interface {
 	Save(user *User) error
 	Find(userName string) (*User, error)
+	Update(user *User) error
+	Modify(userName string, modify func(user *User) error) (*User, error)
+	Delete(userName string) error
+	List() ([]*User, error)
 }
 
 //InMemoryUserStore stores the user data
@@ -26,17 +34,16 @@ type InMemoryUserStore struct {
 	Users map[string]*User
 }
 
-//NewUser creates a new user on ths system
-func NewUser(userName string, password string, role string) (*User, error) {
-	hashedPass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return nil, fmt.Errorf("cannot hash password: %w", err)
+//NewUser creates a new user on ths system, the password is hashed by the hasher
+func NewUser(hasher PasswordHasher, userName string, password string, roles ...string) (*User, error) {
+	user := &User{
+		UserName: userName,
+		Roles:    roles,
 	}
 
-	user := &User{
-		HashedPassword: string(hashedPass),
-		UserName:       userName,
-		Role:           role,
+	err := user.SetPassword(hasher, password)
+	if err != nil {
+		return nil, err
 	}
 
 	return user, nil
@@ -75,10 +82,85 @@ func (store *InMemoryUserStore) Find(userName string) (*User, error) {
 	return user.Clone(), nil
 }
 
-//IsCorrectPassword verifies teh password
+//Update replaces the stored user with the same user name
+func (store *InMemoryUserStore) Update(user *User) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.Users[user.UserName] == nil {
+		return ErrNotFound
+	}
+
+	store.Users[user.UserName] = user.Clone()
+	return nil
+}
+
+//Modify applies modify to a copy of the stored user and stores the copy unless modify fails, the
+//read and the write are atomic so concurrent modifications of the same user are not lost
+func (store *InMemoryUserStore) Modify(userName string, modify func(user *User) error) (*User, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	user := store.Users[userName]
+	if user == nil {
+		return nil, ErrNotFound
+	}
+
+	other := user.Clone()
+	err := modify(other)
+	if err != nil {
+		return nil, err
+	}
+
+	store.Users[userName] = other.Clone()
+	return other, nil
+}
+
+//Delete deletes the user from the map
+func (store *InMemoryUserStore) Delete(userName string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.Users[userName] == nil {
+		return ErrNotFound
+	}
+
+	delete(store.Users, userName)
+	return nil
+}
+
+//List returns all the users sorted by user name
+func (store *InMemoryUserStore) List() ([]*User, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	users := make([]*User, 0, len(store.Users))
+	for _, user := range store.Users {
+		users = append(users, user.Clone())
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].UserName < users[j].UserName
+	})
+
+	return users, nil
+}
+
+//SetPassword hashes the password with the hasher and stores it on the user
+func (user *User) SetPassword(hasher PasswordHasher, password string) error {
+	hashedPassword, err := hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	user.HashedPassword = hashedPassword
+	return nil
+}
+
+//IsCorrectPassword verifies teh password, whichever password hasher produced the stored hash
 func (user *User) IsCorrectPassword(password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(password))
-	return err == nil
+	ok, err := VerifyPassword(user.HashedPassword, password)
+	return err == nil && ok
 }
 
 //Clone clones the data replica
@@ -86,6 +168,10 @@ func (user *User) Clone() *User {
 	return &User{
 		UserName:       user.UserName,
 		HashedPassword: user.HashedPassword,
-		Role:           user.Role,
+		Roles:          append([]string(nil), user.Roles...),
+		Tenant:         user.Tenant,
+		TOTPSecret:     user.TOTPSecret,
+		TOTPEnabled:    user.TOTPEnabled,
+		TOTPCounter:    user.TOTPCounter,
 	}
 }